@@ -0,0 +1,174 @@
+package evalostic
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// FindingKind is the kind of problem that Analyze found in a condition
+type FindingKind int8
+
+const (
+	FindingInvalid       FindingKind = iota // the condition can not be parsed
+	FindingNeverMatches                     // the condition is a contradiction, e.g. "a" AND NOT "a"
+	FindingAlwaysMatches                    // the condition matches every string, e.g. NOT "a" OR "a"
+	FindingNegative                         // the condition can match without strings, so it is evaluated for every input
+	FindingEquivalent                       // the condition matches the same strings as another condition
+	FindingSubsumed                         // the condition only matches if another condition matches
+	FindingShortString                      // the condition contains a string that is found in almost every input
+)
+
+// analyzeMaxShortString is the maximum number of characters of a string that is reported as FindingShortString
+const analyzeMaxShortString = 2
+
+func (k FindingKind) String() string {
+	switch k {
+	case FindingInvalid:
+		return "invalid"
+	case FindingNeverMatches:
+		return "never matches"
+	case FindingAlwaysMatches:
+		return "always matches"
+	case FindingNegative:
+		return "negative"
+	case FindingEquivalent:
+		return "equivalent"
+	case FindingSubsumed:
+		return "subsumed"
+	case FindingShortString:
+		return "short string"
+	default:
+		return fmt.Sprintf("FindingKind(%d)", k)
+	}
+}
+
+// Finding is a problem of a condition that Analyze found
+type Finding struct {
+	Kind      FindingKind
+	Condition int    // index of the condition
+	Other     int    // index of the other condition of FindingEquivalent and FindingSubsumed, -1 otherwise
+	Str       string // the string of FindingShortString, empty otherwise
+	Message   string // description of the problem
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("condition %d: %s", f.Condition, f.Message)
+}
+
+// Analyze checks the conditions of a rule set and returns the findings ordered by the index of the condition and their
+// kind. Different strings, regexes, counts etc. are treated as independent of each other, e.g. Analyze does not know
+// that "ab" is only found if "a" is found. Therefore all findings are correct, but some problems may not be found.
+// Conditions that never match or always match are not compared with other conditions.
+func Analyze(conditions []string) []Finding {
+	roots, _, errs := parseConditions(conditions)
+	var findings []Finding
+	for _, err := range errs {
+		msg := fmt.Sprintf("pos %d:%d: %s", err.Line, err.Column, err.Message)
+		if err.Expected != "" {
+			msg += ", expected " + err.Expected
+		}
+		findings = append(findings, Finding{Kind: FindingInvalid, Condition: err.Condition, Other: -1, Message: msg})
+	}
+	var valid []node
+	for _, root := range roots {
+		if root != nil {
+			valid = append(valid, root)
+		}
+	}
+	s := newSimplifier(valid...)
+	bddRoots := make(map[int]int)     // root in the BDD of each condition
+	byRoot := make(map[int]int)       // first condition of each root in the BDD
+	byLeaf := make(map[literal][]int) // conditions that contain each leaf
+	for i, root := range roots {
+		if root == nil {
+			continue // empty conditions, definitions and invalid conditions
+		}
+		add := func(kind FindingKind, format string, args ...interface{}) {
+			findings = append(findings, Finding{Kind: kind, Condition: i, Other: -1, Message: fmt.Sprintf(format, args...)})
+		}
+		shortStrings := make(map[string]struct{})
+		walk(root, func(n node) {
+			val, ok := n.(nodeVAL)
+			if !ok || utf8.RuneCountInString(val.nodeValue) > analyzeMaxShortString {
+				return
+			}
+			if _, ok := shortStrings[val.Condition()]; !ok {
+				shortStrings[val.Condition()] = struct{}{}
+				findings = append(findings, Finding{
+					Kind:      FindingShortString,
+					Condition: i,
+					Other:     -1,
+					Str:       val.nodeValue,
+					Message:   fmt.Sprintf("string %s is too short, it is found in almost every input", val.Condition()),
+				})
+			}
+		})
+		bddRoot := s.bdd.build(root, s.atoms)
+		switch bddRoot {
+		case bddFalse:
+			add(FindingNeverMatches, "condition never matches")
+			continue
+		case bddTrue:
+			add(FindingAlwaysMatches, "condition matches every string")
+			continue
+		}
+		if _, positive := extractStrings(root); !positive {
+			add(FindingNegative, "condition can match without any string, so it is evaluated for every input")
+		}
+		if other, ok := byRoot[bddRoot]; ok {
+			findings = append(findings, Finding{
+				Kind:      FindingEquivalent,
+				Condition: i,
+				Other:     other,
+				Message:   fmt.Sprintf("condition is equivalent to condition %d", other),
+			})
+			continue
+		}
+		byRoot[bddRoot] = i
+		bddRoots[i] = bddRoot
+		leaves := make(map[literal]struct{})
+		walk(root, func(n node) {
+			if l, ok := n.(leaf); ok {
+				leaves[l.literal()] = struct{}{}
+			}
+		})
+		for l := range leaves {
+			byLeaf[l] = append(byLeaf[l], i)
+		}
+	}
+	// a condition can only imply another condition that is not constant if both have a leaf in common
+	compared := make(map[[2]int]struct{})
+	for _, indices := range byLeaf {
+		for _, i := range indices {
+			for _, j := range indices {
+				if _, ok := compared[[2]int{i, j}]; ok || i == j {
+					continue
+				}
+				compared[[2]int{i, j}] = struct{}{}
+				if s.implies(bddRoots[i], bddRoots[j]) {
+					findings = append(findings, Finding{
+						Kind:      FindingSubsumed,
+						Condition: i,
+						Other:     j,
+						Message:   fmt.Sprintf("condition only matches if condition %d matches", j),
+					})
+				}
+			}
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		f1, f2 := findings[i], findings[j]
+		if f1.Condition != f2.Condition {
+			return f1.Condition < f2.Condition
+		}
+		if f1.Kind != f2.Kind {
+			return f1.Kind < f2.Kind
+		}
+		if f1.Other != f2.Other {
+			return f1.Other < f2.Other
+		}
+		return f1.Str < f2.Str
+	})
+	return findings
+}
@@ -0,0 +1,57 @@
+package evalostic
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	findings := Analyze([]string{
+		`"foo" AND NOT "foo"`,
+		`NOT "bar" OR "bar"`,
+		`NOT "foo" AND NOT "bar"`,
+		`"foo" AND "bar"`,
+		`"bar" AND NOT (NOT "foo")`,
+		`"foo"`,
+		`"foo" AND`,
+		`$short = "ab"`,
+		`$short NEAR/3 "foo"`,
+		``,
+		`/ba+r/ OR "baz"`,
+	})
+	var kinds []FindingKind
+	var pairs [][2]int
+	for _, f := range findings {
+		kinds = append(kinds, f.Kind)
+		pairs = append(pairs, [2]int{f.Condition, f.Other})
+	}
+	assertTrue(t, reflect.DeepEqual(kinds, []FindingKind{
+		FindingNeverMatches,
+		FindingAlwaysMatches,
+		FindingNegative,
+		FindingSubsumed,
+		FindingEquivalent,
+		FindingInvalid,
+		FindingShortString,
+	}))
+	assertTrue(t, reflect.DeepEqual(pairs, [][2]int{{0, -1}, {1, -1}, {2, -1}, {3, 5}, {4, 3}, {6, -1}, {8, -1}}))
+	assertTrue(t, findings[5].String() == "condition 6: pos 1:7: missing operand after AND, expected a string or a subcondition")
+	assertTrue(t, findings[6].Str == "ab")
+	assertTrue(t, len(Analyze(nil)) == 0)
+}
+
+func ExampleAnalyze() {
+	for _, finding := range Analyze([]string{
+		`"foo" AND NOT "foo"`,
+		`"foo" OR "bar"`,
+		`"bar" AND "baz"`,
+		`NOT "foo"`,
+	}) {
+		fmt.Printf("%s: %s\n", finding.Kind, finding)
+	}
+	// Output:
+	// never matches: condition 0: condition never matches
+	// subsumed: condition 2: condition only matches if condition 1 matches
+	// negative: condition 3: condition can match without any string, so it is evaluated for every input
+}
@@ -0,0 +1,439 @@
+package evalostic
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// identifier matches the names of fields
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// Expr is an expression of the abstract syntax tree of a condition. Expressions can be built with And, Or, Not, Str
+// etc., parsed from conditions with ParseCondition and compiled with NewFromExprs.
+type Expr interface {
+	// String returns the expression in the syntax of conditions
+	String() string
+	node() (node, error)
+}
+
+type (
+	// AndExpr matches if all of its expressions match
+	AndExpr struct{ Exprs []Expr }
+	// OrExpr matches if at least one of its expressions matches
+	OrExpr struct{ Exprs []Expr }
+	// XorExpr matches if exactly one of both expressions matches
+	XorExpr struct{ X, Y Expr }
+	// ImpliesExpr matches if X does not match or both expressions match
+	ImpliesExpr struct{ X, Y Expr }
+	// NotExpr matches if its expression does not match
+	NotExpr struct{ X Expr }
+	// OfExpr matches if at least Min of its expressions match
+	OfExpr struct {
+		Min   int
+		Exprs []Expr
+	}
+	// StrExpr is a string, a regular expression or a wildcard pattern
+	StrExpr struct {
+		Kind            StrKind
+		Value           string
+		Field           string // empty if the string can be found in any field
+		CaseInsensitive bool
+		Anchor          Anchor // only allowed for strings
+		Word            bool   // only allowed for strings, the string must not be part of a longer word
+	}
+	// NearExpr matches if both strings occur with a limited distance between them
+	NearExpr struct {
+		X, Y StrExpr
+		Gap  Gap
+	}
+	// ThenExpr matches if the strings occur in order, Gaps[i] limits the gap between Strs[i] and Strs[i+1]
+	ThenExpr struct {
+		Strs []StrExpr
+		Gaps []Gap
+	}
+	// CountExpr compares the number of occurrences of a string with Count
+	CountExpr struct {
+		Str         StrExpr
+		Comparison  string // one of >=, >, <=, <, == and !=
+		Count       int
+		Overlapping bool // count overlapping occurrences, e.g. "aa" occurs twice in "aaa"
+	}
+	// NumExpr compares the numeric value of a field with Value, or checks that it is between Value and Max
+	NumExpr struct {
+		Field      string
+		Comparison string // one of >=, >, <=, <, == and !=, ignored if Between is set
+		Value      float64
+		Max        float64
+		Between    bool
+	}
+)
+
+// StrKind is the kind of a StrExpr
+type StrKind int8
+
+const (
+	KindString   StrKind = iota // "foo"
+	KindRegex                   // /fo+/
+	KindWildcard                // w"f*o"
+)
+
+// Anchor restricts the position of a string
+type Anchor int8
+
+const (
+	AnchorNone  Anchor = iota
+	AnchorStart        // ^"foo": the string has to start with foo
+	AnchorEnd          // "foo"$: the string has to end with foo
+	AnchorEqual        // ="foo": the string has to be equal to foo
+)
+
+// Gap is the maximum distance between the strings of a NearExpr or a ThenExpr
+type Gap struct {
+	Distance int  // -1 if the distance is not limited
+	Words    bool // the distance is measured in words instead of characters
+}
+
+// And returns an expression that matches if all expressions match
+func And(exprs ...Expr) AndExpr { return AndExpr{Exprs: exprs} }
+
+// Or returns an expression that matches if at least one expression matches
+func Or(exprs ...Expr) OrExpr { return OrExpr{Exprs: exprs} }
+
+// Xor returns an expression that matches if exactly one of both expressions matches
+func Xor(x, y Expr) XorExpr { return XorExpr{X: x, Y: y} }
+
+// Implication returns an expression that matches if x does not match or both expressions match, i.e. x IMPLIES y
+func Implication(x, y Expr) ImpliesExpr { return ImpliesExpr{X: x, Y: y} }
+
+// Not returns an expression that matches if the expression does not match
+func Not(x Expr) NotExpr { return NotExpr{X: x} }
+
+// NOf returns an expression that matches if at least min expressions match
+func NOf(min int, exprs ...Expr) OfExpr { return OfExpr{Min: min, Exprs: exprs} }
+
+// AnyOf returns an expression that matches if at least one expression matches
+func AnyOf(exprs ...Expr) OfExpr { return NOf(1, exprs...) }
+
+// AllOf returns an expression that matches if all expressions match
+func AllOf(exprs ...Expr) OfExpr { return NOf(len(exprs), exprs...) }
+
+// Str returns a case sensitive string that can be found in any field
+func Str(s string) StrExpr { return StrExpr{Kind: KindString, Value: s} }
+
+// Regex returns a case sensitive regular expression that can be found in any field
+func Regex(pattern string) StrExpr { return StrExpr{Kind: KindRegex, Value: pattern} }
+
+// Wildcard returns a case sensitive wildcard pattern that can be found in any field
+func Wildcard(pattern string) StrExpr { return StrExpr{Kind: KindWildcard, Value: pattern} }
+
+// ParseCondition parses a single condition into an expression, named lists and named conditions are not supported.
+func ParseCondition(condition string) (Expr, error) {
+	roots, _, errs := parseConditions([]string{condition})
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("could not parse condition: %w", errs[0])
+	}
+	if roots[0] == nil {
+		return nil, errors.New("condition is empty or a definition")
+	}
+	return exprOf(roots[0]), nil
+}
+
+// NewFromExprs builds a new Evalostic matcher like NewWithOptions from expressions instead of conditions. With the
+// option SkipInvalid the errors of invalid expressions are returned as ParseErrors without a position.
+func NewFromExprs(exprs []Expr, options Options) (*Evalostic, error) {
+	return newFromExprs(exprs, nil, options)
+}
+
+// newFromExprs builds the matcher of the expressions, invalid contains the errors of expressions that could not be
+// decoded by their index
+func newFromExprs(exprs []Expr, invalid map[int]error, options Options) (*Evalostic, error) {
+	roots := make([]node, len(exprs))
+	var errs []*ParseError
+	for i, expr := range exprs {
+		err, ok := invalid[i]
+		if !ok {
+			roots[i], err = toNode(expr)
+		}
+		if err != nil {
+			if !options.SkipInvalid {
+				return nil, fmt.Errorf("expression %d: %w", i, err)
+			}
+			errs = append(errs, &ParseError{Condition: i, Message: err.Error()})
+		}
+	}
+	e := newEvalostic(roots, nil, options)
+	if len(errs) > 0 {
+		return e, &MultiError{Errors: errs}
+	}
+	return e, nil
+}
+
+// toNode converts the expression to a node and checks it like the parser checks conditions
+func toNode(expr Expr) (node, error) {
+	if expr == nil {
+		return nil, errors.New("missing expression")
+	}
+	return expr.node()
+}
+
+// exprOf converts a node to an expression, nested nodeANDs and nodeORs are merged
+func exprOf(n node) Expr {
+	switch v := n.(type) {
+	case nodeAND:
+		var exprs []Expr
+		for _, subNode := range flattenAnd(v) {
+			exprs = append(exprs, exprOf(subNode))
+		}
+		return AndExpr{Exprs: exprs}
+	case nodeOR:
+		var exprs []Expr
+		for _, subNode := range flattenOr(v) {
+			exprs = append(exprs, exprOf(subNode))
+		}
+		return OrExpr{Exprs: exprs}
+	case nodeXOR:
+		return XorExpr{X: exprOf(v.node1), Y: exprOf(v.node2)}
+	case nodeIMPLIES:
+		return ImpliesExpr{X: exprOf(v.node1), Y: exprOf(v.node2)}
+	case nodeNOT:
+		return NotExpr{X: exprOf(v.node)}
+	case nodeOF:
+		exprs := make([]Expr, len(v.nodes))
+		for i, subNode := range v.nodes {
+			exprs[i] = exprOf(subNode)
+		}
+		return OfExpr{Min: v.min, Exprs: exprs}
+	case nodeVAL:
+		return strExprOf(v)
+	case nodeREGEX:
+		return StrExpr{Kind: KindRegex, Value: v.nodeValue, Field: v.field, CaseInsensitive: v.caseInsensitive}
+	case nodeWILDCARD:
+		return StrExpr{Kind: KindWildcard, Value: v.nodeValue, Field: v.field, CaseInsensitive: v.caseInsensitive}
+	case nodeNEAR:
+		return NearExpr{X: strExprOf(v.val1), Y: strExprOf(v.val2), Gap: Gap{Distance: v.gap.distance, Words: v.gap.words}}
+	case nodeTHEN:
+		then := ThenExpr{Strs: make([]StrExpr, len(v.vals)), Gaps: make([]Gap, len(v.gaps))}
+		for i, val := range v.vals {
+			then.Strs[i] = strExprOf(val)
+		}
+		for i, g := range v.gaps {
+			then.Gaps[i] = Gap{Distance: g.distance, Words: g.words}
+		}
+		return then
+	case nodeCOUNT:
+		return CountExpr{Str: strExprOf(v.val), Comparison: v.comparison.String(), Count: v.count, Overlapping: v.overlapping}
+	case nodeNUM:
+		if v.between {
+			return NumExpr{Field: v.field, Value: v.value, Max: v.max, Between: true}
+		}
+		return NumExpr{Field: v.field, Comparison: v.comparison.String(), Value: v.value}
+	default:
+		panic("unknown node type")
+	}
+}
+
+func strExprOf(n nodeVAL) StrExpr {
+	return StrExpr{
+		Kind:            KindString,
+		Value:           n.nodeValue,
+		Field:           n.field,
+		CaseInsensitive: n.caseInsensitive,
+		Anchor:          Anchor(n.anchor),
+		Word:            n.word,
+	}
+}
+
+// exprString returns the condition of the expression, or a description of the error if it is invalid
+func exprString(expr Expr) string {
+	n, err := toNode(expr)
+	if err != nil {
+		return fmt.Sprintf("<invalid expression: %s>", err)
+	}
+	return n.Condition()
+}
+
+func (e AndExpr) String() string     { return exprString(e) }
+func (e OrExpr) String() string      { return exprString(e) }
+func (e XorExpr) String() string     { return exprString(e) }
+func (e ImpliesExpr) String() string { return exprString(e) }
+func (e NotExpr) String() string     { return exprString(e) }
+func (e OfExpr) String() string      { return exprString(e) }
+func (e StrExpr) String() string     { return exprString(e) }
+func (e NearExpr) String() string    { return exprString(e) }
+func (e ThenExpr) String() string    { return exprString(e) }
+func (e CountExpr) String() string   { return exprString(e) }
+func (e NumExpr) String() string     { return exprString(e) }
+
+// nodes converts the expressions and merges them with the binary operator
+func nodes(operator string, exprs []Expr, merge func(n1, n2 node) node) (node, error) {
+	if len(exprs) == 0 {
+		return nil, fmt.Errorf("%s requires at least one expression", operator)
+	}
+	var res node
+	for _, expr := range exprs {
+		n, err := toNode(expr)
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			res = n
+		} else {
+			res = merge(res, n)
+		}
+	}
+	return res, nil
+}
+
+func (e AndExpr) node() (node, error) {
+	return nodes("AND", e.Exprs, func(n1, n2 node) node { return nodeAND{twoSubNodes{n1, n2}} })
+}
+
+func (e OrExpr) node() (node, error) {
+	return nodes("OR", e.Exprs, func(n1, n2 node) node { return nodeOR{twoSubNodes{n1, n2}} })
+}
+
+func (e XorExpr) node() (node, error) {
+	return nodes("XOR", []Expr{e.X, e.Y}, func(n1, n2 node) node { return nodeXOR{twoSubNodes{n1, n2}} })
+}
+
+func (e ImpliesExpr) node() (node, error) {
+	return nodes("IMPLIES", []Expr{e.X, e.Y}, func(n1, n2 node) node { return nodeIMPLIES{twoSubNodes{n1, n2}} })
+}
+
+func (e NotExpr) node() (node, error) {
+	n, err := toNode(e.X)
+	if err != nil {
+		return nil, err
+	}
+	return nodeNOT{oneSubNode{node: n}}, nil
+}
+
+func (e OfExpr) node() (node, error) {
+	of := nodeOF{min: e.Min}
+	for _, expr := range e.Exprs {
+		n, err := toNode(expr)
+		if err != nil {
+			return nil, err
+		}
+		of.nodes = append(of.nodes, n)
+	}
+	if e.Min < 1 || e.Min > len(of.nodes) {
+		return nil, fmt.Errorf("threshold must be between 1 and %d, got: %d", len(of.nodes), e.Min)
+	}
+	return of, nil
+}
+
+func (e StrExpr) node() (node, error) {
+	value := valueNode{nodeValue: e.Value, caseInsensitive: e.CaseInsensitive, field: e.Field}
+	if e.Field != "" && !identifier.MatchString(e.Field) {
+		return nil, fmt.Errorf("invalid field %q", e.Field)
+	}
+	if e.Kind != KindString && (e.Anchor != AnchorNone || e.Word) {
+		return nil, fmt.Errorf("anchors and whole words are only allowed for strings, got: %s", e.Value)
+	}
+	switch e.Kind {
+	case KindString:
+		if e.Anchor < AnchorNone || e.Anchor > AnchorEqual {
+			return nil, fmt.Errorf("invalid anchor %d", e.Anchor)
+		}
+		return nodeVAL{valueNode: value, anchor: anchor(e.Anchor), word: e.Word}, nil
+	case KindRegex:
+		regex := nodeREGEX{value}
+		// the lexer reads // as a comment, so conditions cannot contain empty regexes
+		if e.Value == "" {
+			return nil, errors.New("empty regex")
+		}
+		if _, err := compileRegex(regex.literal()); err != nil {
+			return nil, fmt.Errorf("invalid regex %s: %s", regex.Condition(), err)
+		}
+		return regex, nil
+	case KindWildcard:
+		return nodeWILDCARD{value}, nil
+	default:
+		return nil, fmt.Errorf("invalid kind %d", e.Kind)
+	}
+}
+
+// val converts the string to a nodeVAL, operand describes where the string is used
+func (e StrExpr) val(operand string) (nodeVAL, error) {
+	if e.Kind != KindString {
+		return nodeVAL{}, fmt.Errorf("%s requires strings, got: %s", operand, e)
+	}
+	n, err := e.node()
+	if err != nil {
+		return nodeVAL{}, err
+	}
+	return n.(nodeVAL), nil
+}
+
+func (e NearExpr) node() (node, error) {
+	val1, err := e.X.val("NEAR")
+	if err != nil {
+		return nil, err
+	}
+	val2, err := e.Y.val("NEAR")
+	if err != nil {
+		return nil, err
+	}
+	if e.Gap.Distance < 0 {
+		return nil, errors.New("NEAR requires a distance")
+	}
+	if val1.field != val2.field {
+		return nil, errors.New("NEAR requires two strings of the same field")
+	}
+	return nodeNEAR{val1: val1, val2: val2, gap: gap{distance: e.Gap.Distance, words: e.Gap.Words}}, nil
+}
+
+func (e ThenExpr) node() (node, error) {
+	if len(e.Strs) < 2 || len(e.Gaps) != len(e.Strs)-1 {
+		return nil, fmt.Errorf("THEN requires at least two strings and one gap less than strings, got: %d strings, %d gaps", len(e.Strs), len(e.Gaps))
+	}
+	then := nodeTHEN{vals: make([]nodeVAL, len(e.Strs)), gaps: make([]gap, len(e.Gaps))}
+	for i, str := range e.Strs {
+		val, err := str.val("THEN")
+		if err != nil {
+			return nil, err
+		}
+		if val.field != e.Strs[0].Field {
+			return nil, errors.New("THEN requires strings of the same field")
+		}
+		then.vals[i] = val
+	}
+	for i, g := range e.Gaps {
+		then.gaps[i] = gap{distance: g.Distance, words: g.Words}
+		if g.Distance < 0 {
+			then.gaps[i] = gap{distance: -1} // the unlimited gap has no unit
+		}
+	}
+	return then, nil
+}
+
+func (e CountExpr) node() (node, error) {
+	val, err := e.Str.val("#")
+	if err != nil {
+		return nil, err
+	}
+	comparison, err := parseComparison(e.Comparison)
+	if err != nil {
+		return nil, err
+	}
+	return nodeCOUNT{val: val, comparison: comparison, count: e.Count, overlapping: e.Overlapping}, nil
+}
+
+func (e NumExpr) node() (node, error) {
+	if !identifier.MatchString(e.Field) {
+		return nil, fmt.Errorf("invalid field %q", e.Field)
+	}
+	if e.Between {
+		if e.Value > e.Max {
+			return nil, fmt.Errorf("invalid range of field %s: %s is greater than %s", e.Field, formatNum(e.Value), formatNum(e.Max))
+		}
+		return nodeNUM{field: e.Field, value: e.Value, max: e.Max, between: true}, nil
+	}
+	comparison, err := parseComparison(e.Comparison)
+	if err != nil {
+		return nil, err
+	}
+	return nodeNUM{field: e.Field, comparison: comparison, value: e.Value}, nil
+}
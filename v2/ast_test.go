@@ -0,0 +1,86 @@
+package evalostic
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseCondition(t *testing.T) {
+	for _, condition := range []string{
+		`"foo" AND NOT ("bar" OR "baz")`,
+		`"a" AND "b" AND "c" OR "d"`,
+		`user:^"root"iw XOR host:/^srv\d+/i -> NOT w"*.exe"`,
+		`2 OF ("a", "b" OR "c", NOT "d")`,
+		`#"foo"o >= 3 AND "a" NEAR/3W "b"i AND "a" THEN/5 "b" THEN "c"`,
+		`status >= 500 AND duration BETWEEN 0.5 AND 5`,
+	} {
+		expr, err := ParseCondition(condition)
+		assertTrue(t, err == nil)
+		reparsed, err := ParseCondition(expr.String())
+		assertTrue(t, err == nil)
+		assertTrue(t, reflect.DeepEqual(expr, reparsed))
+	}
+	expr, err := ParseCondition(`"a" AND ("b" AND "c") OR NOT "d"`)
+	assertTrue(t, err == nil)
+	assertTrue(t, reflect.DeepEqual(expr, Or(And(Str("a"), Str("b"), Str("c")), Not(Str("d")))))
+	for _, invalid := range []string{``, `"a" AND`, `$a = "a"`, `$a`} {
+		_, err = ParseCondition(invalid)
+		assertTrue(t, err != nil)
+	}
+}
+
+func TestNewFromExprs(t *testing.T) {
+	root := Str("root")
+	root.Field, root.Word = "user", true
+	e, err := NewFromExprs([]Expr{
+		And(Str("foo"), Not(Or(Str("bar"), Regex(`ba+z`)))),
+		AnyOf(root, NumExpr{Field: "status", Comparison: ">=", Value: 500}),
+		ThenExpr{Strs: []StrExpr{Str("a"), Str("b")}, Gaps: []Gap{{Distance: -1}}},
+	}, Options{})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match("foo"), []int{0}))
+	assertTrue(t, sameIntegers(e.Match("foo baaaz"), []int{}))
+	assertTrue(t, sameIntegers(e.Match("b a b"), []int{2}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"user": "root"}), []int{1}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"user": "chroot", "status": "503"}), []int{1}))
+	for _, invalid := range []Expr{
+		nil,
+		And(),
+		Not(nil),
+		NOf(3, Str("a"), Str("b")),
+		Regex(`(`),
+		Regex(""),
+		StrExpr{Kind: KindRegex, Value: "a", Word: true},
+		StrExpr{Value: "a", Field: "not a field"},
+		NearExpr{X: Str("a"), Y: Regex("b"), Gap: Gap{Distance: 3}},
+		ThenExpr{Strs: []StrExpr{Str("a")}},
+		CountExpr{Str: Str("a"), Comparison: "=>", Count: 1},
+		NumExpr{Field: "status", Between: true, Value: 2, Max: 1},
+	} {
+		_, err = NewFromExprs([]Expr{Str("valid"), invalid}, Options{})
+		assertTrue(t, err != nil)
+	}
+	e, err = NewFromExprs([]Expr{Str("a"), And(), Str("b")}, Options{SkipInvalid: true, Backend: BackendBDD})
+	var multiErr *MultiError
+	assertTrue(t, errors.As(err, &multiErr) && sameIntegers(multiErr.Indices(), []int{1}))
+	assertTrue(t, sameIntegers(e.Match("a b"), []int{0, 2}))
+}
+
+func ExampleNewFromExprs() {
+	admin := Str("admin")
+	admin.CaseInsensitive = true
+	expr := And(Or(Str("root"), admin), Not(Regex(`sudo\s+-s`)))
+	fmt.Println(expr)
+	e, err := NewFromExprs([]Expr{expr}, Options{})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(e.Match("ADMIN login"))
+	fmt.Println(e.Match("root: sudo -s"))
+	// Output:
+	// (("root" OR "admin"i) AND NOT /sudo\s+-s/)
+	// [0]
+	// []
+}
@@ -0,0 +1,93 @@
+package evalostic
+
+// automaton is an Aho-Corasick automaton that, in contrast to github.com/Codehardt/go-ahocorasick, also reports the
+// positions of all occurrences of the strings
+type automaton struct {
+	nodes []automatonNode
+	empty []int // indices of empty strings, they can be found at every position
+}
+
+type automatonNode struct {
+	children   map[byte]int
+	fail       int   // the node of the longest proper suffix of this node that is also in the trie
+	outputs    []int // indices of the strings that end in this node
+	outputLink int   // the next node on the fail chain that has outputs, -1 if there is none
+}
+
+func newAutomaton(strs []string) *automaton {
+	a := &automaton{nodes: []automatonNode{{children: make(map[byte]int), outputLink: -1}}}
+	for i, str := range strs {
+		if str == "" {
+			a.empty = append(a.empty, i)
+			continue
+		}
+		var n int
+		for j := 0; j < len(str); j++ {
+			child, ok := a.nodes[n].children[str[j]]
+			if !ok {
+				child = len(a.nodes)
+				a.nodes = append(a.nodes, automatonNode{children: make(map[byte]int), outputLink: -1})
+				a.nodes[n].children[str[j]] = child
+			}
+			n = child
+		}
+		a.nodes[n].outputs = append(a.nodes[n].outputs, i)
+	}
+	// the fail links are set in breadth first order, so the fail links of all shorter prefixes are already known
+	var queue []int
+	for _, child := range a.nodes[0].children {
+		queue = append(queue, child) // the fail link of nodes with depth 1 is always the root
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for b, child := range a.nodes[n].children {
+			fail := a.nodes[n].fail
+			for {
+				if next, ok := a.nodes[fail].children[b]; ok {
+					a.nodes[child].fail = next
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = a.nodes[fail].fail
+			}
+			if failNode := a.nodes[a.nodes[child].fail]; len(failNode.outputs) > 0 {
+				a.nodes[child].outputLink = a.nodes[child].fail
+			} else {
+				a.nodes[child].outputLink = failNode.outputLink
+			}
+			queue = append(queue, child)
+		}
+	}
+	return a
+}
+
+// find calls found for every occurrence of every string with the index of the string and the position where the
+// occurrence ends
+func (a *automaton) find(text string, found func(i, end int)) {
+	for _, i := range a.empty {
+		for end := 0; end <= len(text); end++ {
+			found(i, end)
+		}
+	}
+	var n int
+	for pos := 0; pos < len(text); pos++ {
+		for {
+			if next, ok := a.nodes[n].children[text[pos]]; ok {
+				n = next
+				break
+			}
+			if n == 0 {
+				break
+			}
+			n = a.nodes[n].fail
+		}
+		for o := n; o > 0; o = a.nodes[o].outputLink {
+			for _, i := range a.nodes[o].outputs {
+				found(i, pos+1)
+			}
+		}
+	}
+}
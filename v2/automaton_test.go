@@ -0,0 +1,56 @@
+package evalostic
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func Example_automaton() {
+	a := newAutomaton([]string{"he", "she", "his", "hers", ""})
+	a.find("ushers", func(i, end int) {
+		if i != 4 {
+			fmt.Println(i, end)
+		}
+	})
+	// Output:
+	// 1 4
+	// 0 4
+	// 3 6
+}
+
+func TestAutomatonAgainstStringsIndex(t *testing.T) {
+	rand.Seed(0)
+	randomText := func(n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abc"[rand.Intn(3)]
+		}
+		return string(b)
+	}
+	for run := 0; run < 100; run++ {
+		strs := make([]string, 1+rand.Intn(10))
+		for i := range strs {
+			strs[i] = randomText(1 + rand.Intn(4))
+		}
+		text := randomText(rand.Intn(30))
+		var expected, actual []string
+		for i, str := range strs {
+			for start := 0; start+len(str) <= len(text); start++ {
+				if strings.HasPrefix(text[start:], str) {
+					expected = append(expected, fmt.Sprintf("%d:%d", i, start+len(str)))
+				}
+			}
+		}
+		newAutomaton(strs).find(text, func(i, end int) {
+			actual = append(actual, fmt.Sprintf("%d:%d", i, end))
+		})
+		sort.Strings(expected)
+		sort.Strings(actual)
+		if strings.Join(expected, ",") != strings.Join(actual, ",") {
+			t.Fatalf("strings %q in text %q: expected %v, got %v", strs, text, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package evalostic
+
+// bdd is a shared reduced ordered binary decision diagram, its variables are the indices of the strings and verified
+// literals. Equivalent sub conditions of all conditions share the same nodes.
+type bdd struct {
+	nodes      []bddNode       // the first two nodes are the terminals false and true
+	unique     map[bddNode]int // index of each node, so that no node is created twice
+	cache      map[bddApply]int
+	thresholds bool // thresholds are built from their sub nodes instead of being a variable
+}
+
+const (
+	bddFalse = 0
+	bddTrue  = 1
+)
+
+// bddNode tests if the literal with the index variable was found, high is the next node if it was found and low if
+// it was not found
+type bddNode struct {
+	variable  int
+	low, high int
+}
+
+type bddOperator int8
+
+const (
+	bddAND bddOperator = iota
+	bddOR
+	bddXOR
+)
+
+// bddApply is the key of the cache of already applied operators
+type bddApply struct {
+	operator bddOperator
+	x, y     int
+}
+
+// terminalVariable is the variable of the terminals, it is greater than all variables, so that terminals are ordered
+// after all other nodes
+const terminalVariable = int(^uint(0) >> 1)
+
+func newBDD() *bdd {
+	return &bdd{
+		nodes: []bddNode{
+			{variable: terminalVariable, low: bddFalse, high: bddFalse},
+			{variable: terminalVariable, low: bddTrue, high: bddTrue},
+		},
+		unique: make(map[bddNode]int),
+		cache:  make(map[bddApply]int),
+	}
+}
+
+// node returns the index of the node with the variable, a node whose low and high are equal is reduced to them
+func (b *bdd) node(variable, low, high int) int {
+	if low == high {
+		return low
+	}
+	n := bddNode{variable: variable, low: low, high: high}
+	if i, ok := b.unique[n]; ok {
+		return i
+	}
+	b.nodes = append(b.nodes, n)
+	b.unique[n] = len(b.nodes) - 1
+	return len(b.nodes) - 1
+}
+
+// apply returns the index of the node that combines the nodes x and y with the operator
+func (b *bdd) apply(operator bddOperator, x, y int) int {
+	switch {
+	case x <= bddTrue && y <= bddTrue:
+		switch operator {
+		case bddAND:
+			return x & y
+		case bddOR:
+			return x | y
+		default:
+			return x ^ y
+		}
+	case operator == bddAND && (x == bddFalse || y == bddFalse):
+		return bddFalse
+	case operator == bddOR && (x == bddTrue || y == bddTrue):
+		return bddTrue
+	case operator == bddAND && x == bddTrue || operator != bddAND && x == bddFalse:
+		return y
+	case operator == bddAND && y == bddTrue || operator != bddAND && y == bddFalse:
+		return x
+	case operator != bddXOR && x == y:
+		return x
+	case operator == bddXOR && x == y:
+		return bddFalse
+	}
+	if x > y {
+		x, y = y, x // all operators are commutative
+	}
+	key := bddApply{operator: operator, x: x, y: y}
+	if res, ok := b.cache[key]; ok {
+		return res
+	}
+	nx, ny := b.nodes[x], b.nodes[y]
+	variable := nx.variable
+	if ny.variable < variable {
+		variable = ny.variable
+	}
+	// the cofactors of a node whose variable is greater than the current variable are the node itself
+	xLow, xHigh, yLow, yHigh := x, x, y, y
+	if nx.variable == variable {
+		xLow, xHigh = nx.low, nx.high
+	}
+	if ny.variable == variable {
+		yLow, yHigh = ny.low, ny.high
+	}
+	res := b.node(variable, b.apply(operator, xLow, yLow), b.apply(operator, xHigh, yHigh))
+	b.cache[key] = res
+	return res
+}
+
+// add adds the condition to the BDD and returns the index of its root, all literals of the condition have to be
+// added to the strings map before
+func (b *bdd) add(n node, strings map[literal]int) int {
+	root := b.build(n, strings)
+	b.cache = make(map[bddApply]int) // the cache is only needed while a condition is added
+	return root
+}
+
+func (b *bdd) build(n node, strings map[literal]int) int {
+	switch v := n.(type) {
+	case nodeAND:
+		return b.apply(bddAND, b.build(v.node1, strings), b.build(v.node2, strings))
+	case nodeOR:
+		return b.apply(bddOR, b.build(v.node1, strings), b.build(v.node2, strings))
+	case nodeXOR:
+		return b.apply(bddXOR, b.build(v.node1, strings), b.build(v.node2, strings))
+	case nodeIMPLIES:
+		return b.apply(bddOR, b.apply(bddXOR, b.build(v.node1, strings), bddTrue), b.build(v.node2, strings))
+	case nodeNOT:
+		return b.apply(bddXOR, b.build(v.node, strings), bddTrue)
+	case nodeOF:
+		if b.thresholds {
+			return b.threshold(v, strings)
+		}
+		return b.node(strings[v.literal()], bddFalse, bddTrue)
+	case leaf:
+		return b.node(strings[v.literal()], bddFalse, bddTrue)
+	default:
+		panic("unknown node type")
+	}
+}
+
+// threshold returns the index of the node that matches if at least min sub nodes of the nodeOF match
+func (b *bdd) threshold(n nodeOF, strings map[literal]int) int {
+	subNodes := make([]int, len(n.nodes))
+	for i, subNode := range n.nodes {
+		subNodes[i] = b.build(subNode, strings)
+	}
+	// atLeast[k] matches if at least k of the sub nodes i and after them match, starting with the last sub node
+	atLeast := make([]int, n.min+1)
+	atLeast[0] = bddTrue
+	for k := 1; k <= n.min; k++ {
+		atLeast[k] = bddFalse
+	}
+	for i := len(subNodes) - 1; i >= 0; i-- {
+		for k := n.min; k >= 1; k-- {
+			found := b.apply(bddAND, subNodes[i], atLeast[k-1])
+			notFound := b.apply(bddAND, b.apply(bddXOR, subNodes[i], bddTrue), atLeast[k])
+			atLeast[k] = b.apply(bddOR, found, notFound)
+		}
+	}
+	return atLeast[n.min]
+}
+
+// eval returns true if the literals that were found satisfy the node, it tests at most one literal per variable
+func (b *bdd) eval(i int, found map[decisionTreeEntry]struct{}) bool {
+	for i > bddTrue {
+		n := b.nodes[i]
+		if _, ok := found[decisionTreeEntry{value: n.variable}]; ok {
+			i = n.high
+		} else {
+			i = n.low
+		}
+	}
+	return i == bddTrue
+}
+
+// bddConditions are the roots of conditions in a BDD, a condition is only evaluated if at least one of its literals
+// was found or if it can match without any literal
+type bddConditions struct {
+	roots      map[int]int   // root of each output
+	candidates map[int][]int // outputs of each literal
+	negatives  []int         // outputs that can match without any literal
+}
+
+func newBDDConditions() *bddConditions {
+	return &bddConditions{
+		roots:      make(map[int]int),
+		candidates: make(map[int][]int),
+	}
+}
+
+// add adds the root of a condition, literals are the indices of all literals of the condition and positive is false
+// if the condition can match without any literal
+func (c *bddConditions) add(output, root int, literals []int, positive bool) {
+	c.roots[output] = root
+	if !positive {
+		c.negatives = append(c.negatives, output)
+		return
+	}
+	for _, l := range literals {
+		c.candidates[l] = append(c.candidates[l], output)
+	}
+}
+
+// find returns the outputs whose conditions are satisfied by the found literals, they may contain duplicates
+func (c *bddConditions) find(b *bdd, found map[decisionTreeEntry]struct{}) (outputs []int) {
+	evaluated := make(map[int]struct{})
+	check := func(output int) {
+		if _, ok := evaluated[output]; ok {
+			return
+		}
+		evaluated[output] = struct{}{}
+		if b.eval(c.roots[output], found) {
+			outputs = append(outputs, output)
+		}
+	}
+	for _, output := range c.negatives {
+		check(output)
+	}
+	for entry := range found {
+		for _, output := range c.candidates[entry.value] {
+			check(output)
+		}
+	}
+	return
+}
@@ -0,0 +1,103 @@
+package evalostic
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Literal is a string, regex, wildcard, count, NEAR, THEN or numeric comparison of a condition and whether it is found
+// in a counterexample. Thresholds are no literals, they are compared by the literals of their elements.
+type Literal struct {
+	Condition string // the literal in the notation of conditions, e.g. "foo"i or #"x" > 2
+	Found     bool
+}
+
+// Equivalent returns true if both conditions match the same strings. Otherwise the counterexample contains all
+// literals of both conditions in order of their first occurrence, exactly one condition matches if the found literals
+// are found and the others are not found. Literals are compared like in Analyze, except that a count with <=, < or
+// != is the negation of the count with >, >= or ==, which is listed in the counterexample instead. Named lists and
+// named conditions are not supported.
+func Equivalent(a, b string) (bool, []Literal, error) {
+	return compareConditions(a, b, bddXOR)
+}
+
+// Implies returns true if the condition b matches whenever the condition a matches. Otherwise the counterexample
+// contains all literals of both conditions like the one of Equivalent, a matches and b does not match.
+func Implies(a, b string) (bool, []Literal, error) {
+	return compareConditions(a, b, bddAND)
+}
+
+// compareConditions returns true if the BDD of the operator never matches, the operator is applied to the BDD of a
+// and, for bddAND, to the negated BDD of b
+func compareConditions(a, b string, operator bddOperator) (bool, []Literal, error) {
+	roots, _, errs := parseConditions([]string{a, b})
+	if len(errs) > 0 {
+		return false, nil, fmt.Errorf("could not parse conditions: %w", errs[0])
+	}
+	if roots[0] == nil || roots[1] == nil {
+		return false, nil, errors.New("condition is empty or a definition")
+	}
+	roots[0], roots[1] = positiveCounts(roots[0]), positiveCounts(roots[1])
+	s := newSimplifier(roots[0], roots[1])
+	rootA, rootB := s.bdd.build(roots[0], s.atoms), s.bdd.build(roots[1], s.atoms)
+	if operator == bddAND {
+		rootB = s.bdd.apply(bddXOR, rootB, bddTrue)
+	}
+	i := s.bdd.apply(operator, rootA, rootB)
+	if i == bddFalse {
+		return true, nil, nil
+	}
+	// every path to the true terminal is a counterexample, literals that are not tested on the path are not found
+	counterexample := make([]Literal, len(s.leaves))
+	for j, l := range s.leaves {
+		counterexample[j] = Literal{Condition: l.Condition()}
+	}
+	for i > bddTrue {
+		n := s.bdd.nodes[i]
+		if n.low == bddFalse {
+			counterexample[n.variable].Found = true
+			i = n.high
+		} else {
+			i = n.low
+		}
+	}
+	return false, counterexample, nil
+}
+
+// positiveCounts replaces the counts with <=, < or != by the negated count with >, >= or ==, so that a count and its
+// negation are the same literal of the BDD
+func positiveCounts(n node) node {
+	switch v := n.(type) {
+	case nodeCOUNT:
+		switch v.comparison {
+		case comparisonLE, comparisonLT, comparisonNE:
+			v.comparison = v.comparison.negate()
+			return nodeNOT{oneSubNode{node: v}}
+		}
+		return v
+	case nodeOF:
+		nodes := make([]node, len(v.nodes))
+		for i, subNode := range v.nodes {
+			nodes[i] = positiveCounts(subNode)
+		}
+		v.nodes = nodes
+		return v
+	case nodeAND:
+		v.node1, v.node2 = positiveCounts(v.node1), positiveCounts(v.node2)
+		return v
+	case nodeOR:
+		v.node1, v.node2 = positiveCounts(v.node1), positiveCounts(v.node2)
+		return v
+	case nodeXOR:
+		v.node1, v.node2 = positiveCounts(v.node1), positiveCounts(v.node2)
+		return v
+	case nodeIMPLIES:
+		v.node1, v.node2 = positiveCounts(v.node1), positiveCounts(v.node2)
+		return v
+	case nodeNOT:
+		v.node = positiveCounts(v.node)
+		return v
+	default:
+		return n
+	}
+}
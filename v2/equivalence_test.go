@@ -0,0 +1,91 @@
+package evalostic
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestEquivalent(t *testing.T) {
+	for _, tc := range []struct {
+		a, b       string
+		equivalent bool
+	}{
+		{`NOT ("a" OR "b")`, `NOT "a" AND NOT "b"`, true},
+		{`"a" -> "b"`, `NOT "a" OR "b"`, true},
+		{`"a" XOR "b"`, `("a" OR "b") AND NOT ("a" AND "b")`, true},
+		{`2 OF ("a", "b")`, `"a" AND "b"`, true},
+		{`ANY OF ("a", "b")`, `"a" OR "b"`, true},
+		{`2 OF ("a", "b" OR "c", NOT "d")`, `"a" AND ("b" OR "c") OR "a" AND NOT "d" OR ("b" OR "c") AND NOT "d"`, true},
+		{`2 OF ("a", "b", "c")`, `ANY OF ("a", "b", "c")`, false},
+		{`"a"i`, `"A"i`, true},
+		{`"a"`, `"A"`, false},
+		{`"a" AND NOT "a"`, `"b" AND NOT "b"`, true},
+		{`NOT #"x" > 2`, `#"x" <= 2`, true},
+		{`#"x" < 3 OR #"x" != 1`, `NOT (#"x" >= 3 AND #"x" == 1)`, true},
+		{`#"x" <= 2`, `#"x" < 2`, false},
+	} {
+		equivalent, counterexample, err := Equivalent(tc.a, tc.b)
+		assertTrue(t, err == nil && equivalent == tc.equivalent && (counterexample == nil) == equivalent)
+	}
+	equivalent, counterexample, err := Equivalent(`"a" OR "b" AND "c"`, `("a" OR "b") AND "c"`)
+	assertTrue(t, err == nil && !equivalent)
+	assertTrue(t, reflect.DeepEqual(counterexample, []Literal{{`"a"`, true}, {`"b"`, false}, {`"c"`, false}}))
+	equivalent, counterexample, err = Equivalent(`#"x" <= 2 AND "a"`, `"a"`)
+	assertTrue(t, err == nil && !equivalent)
+	assertTrue(t, reflect.DeepEqual(counterexample, []Literal{{`#"x" > 2`, true}, {`"a"`, true}}))
+	_, _, err = Equivalent(`"a"`, `"b" AND`)
+	assertTrue(t, err != nil)
+	_, _, err = Equivalent(`$a = "a"`, `"a"`)
+	assertTrue(t, err != nil)
+	// the counterexamples of random conditions are strings that are only matched by one condition
+	rand.Seed(0)
+	for i := 0; i < 200; i++ {
+		a, b := randomCondition(3), randomCondition(3)
+		simplified, err := Simplify(a)
+		assertTrue(t, err == nil)
+		equivalent, _, err := Equivalent(a, simplified)
+		assertTrue(t, err == nil && equivalent)
+		equivalent, counterexample, err := Equivalent(a, b)
+		assertTrue(t, err == nil && !equivalent)
+		e, err := New([]string{a, b})
+		assertTrue(t, err == nil)
+		var s string
+		for _, l := range counterexample {
+			if l.Found {
+				s += l.Condition
+			}
+		}
+		if len(e.Match(s)) != 1 {
+			t.Fatalf("%s, %s: %s is not a counterexample", a, b, s)
+		}
+	}
+}
+
+func TestImplies(t *testing.T) {
+	implies, counterexample, err := Implies(`"a" AND "b"`, `"a" OR "c"`)
+	assertTrue(t, err == nil && implies && counterexample == nil)
+	implies, counterexample, err = Implies(`"a" OR "c"`, `"a" AND "b"`)
+	assertTrue(t, err == nil && !implies)
+	assertTrue(t, reflect.DeepEqual(counterexample, []Literal{{`"a"`, false}, {`"c"`, true}, {`"b"`, false}}))
+	implies, _, err = Implies(`"a" AND NOT "a"`, `"b"`)
+	assertTrue(t, err == nil && implies)
+	_, _, err = Implies(`"a" AND`, `"b"`)
+	assertTrue(t, err != nil)
+}
+
+func ExampleEquivalent() {
+	equivalent, counterexample, err := Equivalent(`NOT ("foo" AND "bar")`, `NOT "foo" AND NOT "bar"`)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(equivalent)
+	for _, l := range counterexample {
+		fmt.Println(l.Condition, l.Found)
+	}
+	// Output:
+	// false
+	// "foo" false
+	// "bar" true
+}
@@ -0,0 +1,104 @@
+package evalostic
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseError describes why and where a condition could not be parsed. New wraps it, so it can be extracted with
+// errors.As.
+type ParseError struct {
+	Condition int    // index of the condition
+	Offset    int    // byte offset of the offending token in the condition
+	Line      int    // line of the offending token, starting at 1
+	Column    int    // column of the offending token in characters, starting at 1
+	Token     string // the offending token as written in the condition, empty at the end of the condition
+	Expected  string // hint what was expected instead of the token, empty if there is no hint
+	Message   string // description of the problem
+	source    string // the condition that could not be parsed
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("condition %d, pos %d:%d: %s", e.Condition, e.Line, e.Column, e.Message)
+	if e.Expected != "" {
+		msg += ", expected " + e.Expected
+	}
+	return msg
+}
+
+// Format returns the error followed by the line of the condition and a caret under the offending token, e.g.
+//
+//	condition 0, pos 1:11: unexpected OR after AND, expected a string or a subcondition
+//	"foo" AND OR "bar"
+//	          ^^
+func (e *ParseError) Format() string {
+	lines := strings.Split(e.source, "\n")
+	if e.Line < 1 || e.Line > len(lines) {
+		return e.Error()
+	}
+	line := lines[e.Line-1]
+	var indent strings.Builder
+	column := 1
+	for _, r := range line {
+		if column >= e.Column {
+			break
+		}
+		if r == '\t' {
+			indent.WriteRune('\t') // keeps the caret aligned with tabs
+		} else {
+			indent.WriteRune(' ')
+		}
+		column++
+	}
+	width := utf8.RuneCountInString(strings.SplitN(e.Token, "\n", 2)[0])
+	if width < 1 {
+		width = 1
+	}
+	return fmt.Sprintf("%s\n%s\n%s%s", e.Error(), line, indent.String(), strings.Repeat("^", width))
+}
+
+// MultiError contains the errors of all invalid conditions in order of their index, it is returned by NewWithOptions,
+// NewFromExprs and NewFromJSON with the option SkipInvalid. Like the errors of errors.Join it implements
+// Unwrap() []error, so errors.Is and errors.As check all contained errors.
+type MultiError struct {
+	Errors []*ParseError
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e *MultiError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Indices returns the indices of all invalid conditions in ascending order
+func (e *MultiError) Indices() []int {
+	indices := make([]int, len(e.Errors))
+	for i, err := range e.Errors {
+		indices[i] = err.Condition
+	}
+	return indices
+}
+
+// errorAt returns a ParseError at the position of the token, the index and the source of the condition are set by
+// parseConditions
+func errorAt(t token, expected string, format string, args ...interface{}) *ParseError {
+	return &ParseError{
+		Offset:   t.pos.offset,
+		Line:     t.pos.line,
+		Column:   t.pos.column,
+		Token:    t.text,
+		Expected: expected,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
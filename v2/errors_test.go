@@ -0,0 +1,61 @@
+package evalostic
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	for _, tc := range []struct {
+		conditions []string
+		condition  int
+		line       int
+		column     int
+		token      string
+		expected   string
+	}{
+		{[]string{`"foo" AND OR "bar"`}, 0, 1, 11, "OR", expectedOperand},
+		{[]string{`"foo"`, `"foo" "bar"`}, 1, 1, 7, `"bar"`, "an operator, e.g. AND"},
+		{[]string{"\"a\" AND\n\t(\"b\" OR"}, 0, 2, 2, "(", `")"`},
+		{[]string{`"a" AND 1 OF ("b",)`}, 0, 1, 18, ",", "a list element"},
+		{[]string{`#"a" >= "b"`}, 0, 1, 9, `"b"`, `a string, a comparison and a number, e.g. #"foo" >= 3`},
+		{[]string{`status BETWEEN 1 OR 2`}, 0, 1, 16, "1", "AND after the lower bound"},
+		{[]string{`"a" ? "b"`}, 0, 1, 5, "?", ""},
+		{[]string{"\"a\" \v"}, 0, 1, 5, "\v", ""},
+		{[]string{"\"a\"\u0085"}, 0, 1, 4, "\u0085", ""},
+		{[]string{"\u00a0\"a\""}, 0, 1, 1, "\u00a0", ""},
+		{[]string{`/* comment */ user: AND`}, 0, 1, 21, "AND", "a string"},
+		{[]string{`"a" AND /(/`}, 0, 1, 9, "/(/", ""},
+		{[]string{`"a"`, `@l = ["a", "b" AND "c"]`, `ANY OF @l`}, 1, 1, 12, `"b"`, "a string"},
+		{[]string{`$a = "x" OR`, `$b = $a`}, 0, 1, 10, "OR", expectedOperand},
+		{[]string{`"x" AND $undefined`}, 0, 1, 9, "$undefined", ""},
+		{[]string{`"a" AND`, `$x = "b" AND`}, 0, 1, 5, "AND", expectedOperand},
+		{[]string{`@l = ["a", "b"]`, `"x" AND @l`}, 1, 1, 9, "@l", "ANY OF, ALL OF or N OF before the list"},
+	} {
+		_, err := New(tc.conditions)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("%v: expected a ParseError, got: %v", tc.conditions, err)
+		}
+		if parseErr.Condition != tc.condition || parseErr.Line != tc.line || parseErr.Column != tc.column ||
+			parseErr.Token != tc.token || parseErr.Expected != tc.expected {
+			t.Errorf("%v: unexpected error: %#v", tc.conditions, parseErr)
+		}
+	}
+}
+
+func ExampleParseError_Format() {
+	_, err := New([]string{
+		`"foo" OR "bar"`,
+		"\"foo\" AND (\n\t\"bar\" OR OR \"baz\"\n)",
+	})
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) {
+		fmt.Println(parseErr.Format())
+	}
+	// Output:
+	// condition 1, pos 2:11: unexpected OR after OR, expected a string or a subcondition
+	// 	"bar" OR OR "baz"
+	// 	         ^^
+}
@@ -2,8 +2,8 @@ package evalostic
 
 import (
 	"fmt"
+	"math"
 	"sort"
-	"strings"
 
 	"github.com/Codehardt/go-ahocorasick"
 )
@@ -12,77 +12,499 @@ import (
 // The biggest optimization is that only conditions that contain at least one keyword of the string will be checked,
 // these strings will be filtered with the Aho-Corasick algorithm. The only exception are negative conditions (see comment of: Negatives() function).
 type Evalostic struct {
-	decisionTree *decisionTreeNode
-	ahoCorasick  ahocorasick.AhoCorasick
-	strings      map[string]int
-	mapping      map[int][]int // which string can be found in which condition
-	orig         []node        // original conditions for export
+	decisionTree      *decisionTreeNode
+	namedDecisionTree *decisionTreeNode           // outputs are indices of names
+	names             []string                    // names of the named conditions in order of their definition
+	fields            map[string]*fieldAutomatons // automatons of each field, "" for unqualified strings
+	strings           map[literal]int
+	positional        map[int]struct{}  // strings whose positions are needed to verify other literals
+	verified          []verifiedLiteral // literals that are verified after the Aho-Corasick prefilter
+	mapping           map[int][]int     // which string can be found in which condition
+	orig              []node            // original conditions for export
+	fallbacks         []int             // conditions that are evaluated as a whole, see Fallbacks
+	fallbackNames     []string          // named conditions that are evaluated as a whole
+	bdd               *bdd              // nil unless the backend is BackendBDD
+	bddConditions     *bddConditions    // outputs are indices of conditions
+	bddNamed          *bddConditions    // outputs are indices of names
+}
+
+// fieldAutomatons find the strings of a single field
+type fieldAutomatons struct {
+	caseSensitive   stringAutomatons // finds all case sensitive strings
+	caseInsensitive stringAutomatons // finds all case insensitive strings in the lowercased input
+}
+
+// stringAutomatons find strings with github.com/Codehardt/go-ahocorasick, except the strings whose positions are needed
+// to verify other literals and empty strings, which are found with an automaton that reports their positions
+type stringAutomatons struct {
+	ahoCorasick     ahocorasick.AhoCorasick
+	positions       *automaton
+	stringIndices   []int    // maps the indices of ahoCorasick to the indices of strings
+	positionIndices []int    // maps the indices of positions to the indices of strings
+	allStrings      []string // strings of both automatons until they are built
+	allIndices      []int    // indices of allStrings in the strings map
+}
+
+func (a *stringAutomatons) add(str string, strI int) {
+	a.allStrings = append(a.allStrings, str)
+	a.allIndices = append(a.allIndices, strI)
+}
+
+// build builds the automatons, positional contains the strings whose positions are needed
+func (a *stringAutomatons) build(positional map[int]struct{}) {
+	var strs, positionStrs []string
+	for i, str := range a.allStrings {
+		strI := a.allIndices[i]
+		if _, ok := positional[strI]; ok || str == "" {
+			positionStrs = append(positionStrs, str)
+			a.positionIndices = append(a.positionIndices, strI)
+		} else {
+			strs = append(strs, str)
+			a.stringIndices = append(a.stringIndices, strI)
+		}
+	}
+	if len(strs) > 0 {
+		a.ahoCorasick = ahocorasick.New(strs)
+	}
+	if len(positionStrs) > 0 {
+		a.positions = newAutomaton(positionStrs)
+	}
+	a.allStrings, a.allIndices = nil, nil
+}
+
+// empty returns true if the automatons have no strings
+func (a *stringAutomatons) empty() bool {
+	return a.ahoCorasick == nil && a.positions == nil
+}
+
+// find adds the strings that are found in s to the match state
+func (a *stringAutomatons) find(m *matchState, s string, positional map[int]struct{}) {
+	if a.ahoCorasick != nil {
+		for _, i := range a.ahoCorasick.Match(s) {
+			m.found[decisionTreeEntry{value: a.stringIndices[i]}] = struct{}{}
+		}
+	}
+	if a.positions != nil {
+		a.positions.find(s, func(i, end int) {
+			m.add(a.positionIndices[i], end, positional)
+		})
+	}
 }
 
 // New builds a new Evalostic matcher that compiles all conditions to one big rule set that can be applied to strings.
 func New(conditions []string) (*Evalostic, error) {
+	return NewWithOptions(conditions, Options{})
+}
+
+// Options configure how NewWithOptions compiles the conditions.
+type Options struct {
+	// SkipInvalid compiles all valid conditions and returns the matcher together with a *MultiError that contains the
+	// errors of all invalid conditions, the caller decides whether the partial rule set is acceptable. Invalid
+	// conditions never match. Without SkipInvalid no matcher is returned if a condition is invalid.
+	SkipInvalid bool
+	// MaxAndPaths limits the number of and-paths of a condition in the decision tree, 0 uses the default of 1024.
+	// Conditions are converted to a sum of products, whose size grows exponentially with ANDs of ORs, e.g.
+	// ("a" OR "b") AND ("c" OR "d") AND ... Conditions that exceed the limit are evaluated as a whole after the
+	// Aho-Corasick prefilter instead, which is slower but does not exhaust the memory. They are reported by Fallbacks.
+	MaxAndPaths int
+	// Backend selects how the conditions are evaluated with the strings that were found, the default is
+	// BackendDecisionTree.
+	Backend Backend
+}
+
+// Backend evaluates the conditions with the strings and literals that were found by the Aho-Corasick automatons.
+type Backend int8
+
+const (
+	// BackendDecisionTree converts each condition to a sum of products and adds the products to a decision tree,
+	// whose paths are followed with the strings that were found. Conditions with more than Options.MaxAndPaths
+	// products are evaluated as a whole.
+	BackendDecisionTree Backend = iota
+	// BackendBDD adds all conditions to a shared reduced ordered binary decision diagram, so that equivalent sub
+	// conditions are stored once. A condition is only evaluated if one of its strings was found or if it can match
+	// without strings, and each string is tested at most once. There are no and-paths, so Options.MaxAndPaths does
+	// not apply.
+	BackendBDD
+)
+
+const defaultMaxAndPaths = 1024
+
+// NewWithOptions builds a new Evalostic matcher like New with additional options.
+func NewWithOptions(conditions []string, options Options) (*Evalostic, error) {
+	roots, named, errs := parseConditions(conditions)
+	// definitions are parsed first, so their errors are sorted by the index of the condition
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Condition < errs[j].Condition })
+	if len(errs) > 0 && !options.SkipInvalid {
+		return nil, fmt.Errorf("could not parse conditions: %w", errs[0])
+	}
+	e := newEvalostic(roots, named, options)
+	if len(errs) > 0 {
+		return e, &MultiError{Errors: errs}
+	}
+	return e, nil
+}
+
+// newEvalostic builds the matcher of the parsed conditions, the indices of the roots are the indices of the
+// conditions and nil roots are skipped
+func newEvalostic(roots []node, named []namedCondition, options Options) *Evalostic {
+	maxAndPaths := options.MaxAndPaths
+	if maxAndPaths <= 0 {
+		maxAndPaths = defaultMaxAndPaths
+	} else if maxAndPaths > math.MaxInt32 {
+		maxAndPaths = math.MaxInt32 // the and-paths are counted without overflow
+	}
 	e := Evalostic{
-		decisionTree: new(decisionTreeNode),
-		strings:      make(map[string]int),
-		mapping:      make(map[int][]int),
-	}
-	e.decisionTree.children = make(map[decisionTreeEntry]*decisionTreeNode)
-	e.decisionTree.notChildren = make(map[decisionTreeEntry]*decisionTreeNode)
-	var stringCounter int
-	var allStrings []string
-	for i, condition := range conditions {
-		if condition == "" {
-			continue // allow empty conditions but ignore them
-		}
-		root, err := parseCondition(condition)
-		if err != nil {
-			return nil, fmt.Errorf("condition %d: %s", i, err)
+		decisionTree:      new(decisionTreeNode),
+		namedDecisionTree: new(decisionTreeNode),
+		fields:            make(map[string]*fieldAutomatons),
+		strings:           make(map[literal]int),
+		positional:        make(map[int]struct{}),
+		mapping:           make(map[int][]int),
+	}
+	for _, tree := range []*decisionTreeNode{e.decisionTree, e.namedDecisionTree} {
+		tree.children = make(map[decisionTreeEntry]*decisionTreeNode)
+		tree.notChildren = make(map[decisionTreeEntry]*decisionTreeNode)
+	}
+	if options.Backend == BackendBDD {
+		e.bdd, e.bddConditions, e.bddNamed = newBDD(), newBDDConditions(), newBDDConditions()
+	}
+	ofNodes := make(map[literal]nodeOF)
+	countNodes := make(map[literal]nodeCOUNT)
+	nearNodes := make(map[literal]nodeNEAR)
+	thenNodes := make(map[literal]nodeTHEN)
+	numNodes := make(map[literal]nodeNUM)
+	conditionNodes := make(map[literal]node)
+	var addString func(str literal) int
+	addString = func(str literal) int {
+		strI, ok := e.strings[str]
+		if ok {
+			return strI
 		}
-		e.orig = append(e.orig, root)
-		condStrings, _ := extractStrings(root)
-		for _, str := range condStrings {
-			strI, ok := e.strings[str]
-			if !ok {
-				strI = stringCounter
-				stringCounter++
-				e.strings[str] = strI
-				allStrings = append(allStrings, str)
+		strI = len(e.strings)
+		e.strings[str] = strI
+		e.fieldAutomatons(str.field) // every field is searched, even if it has no automatons
+		addPrefilter := func(prefilter [][]literal) (indices [][]int) {
+			for _, alternative := range prefilter {
+				var alternativeIndices []int
+				for _, prefilterStr := range alternative {
+					prefilterStr.field = str.field
+					alternativeIndices = append(alternativeIndices, addString(prefilterStr))
+				}
+				indices = append(indices, alternativeIndices)
 			}
-			e.mapping[strI] = append(e.mapping[strI], i)
+			return
+		}
+		switch {
+		case str.kind == literalRegex:
+			re := mustCompileRegex(str)
+			e.verified = append(e.verified, verifiedLiteral{
+				field:     str.field,
+				index:     strI,
+				prefilter: addPrefilter(regexPrefilter(str)),
+				verify:    func(m *matchState) bool { return re.MatchString(m.s) },
+			})
+		case str.kind == literalWildcard:
+			e.verified = append(e.verified, verifiedLiteral{
+				field:     str.field,
+				index:     strI,
+				prefilter: addPrefilter(wildcardPrefilter(str)),
+				verify:    wildcardMatcher(str),
+			})
+		case str.kind == literalOf:
+			// the sub nodes are added first, so they are verified before the nodeOF
+			of := ofNodes[str]
+			var prefilter [][]int
+			for _, subNode := range of.nodes {
+				subStrings, positive := extractStrings(subNode)
+				for _, subStr := range subStrings {
+					subI := addString(subStr)
+					if positive {
+						prefilter = append(prefilter, []int{subI})
+					}
+				}
+			}
+			if _, positive := extractStrings(of); !positive {
+				prefilter = nil
+			}
+			e.verified = append(e.verified, verifiedLiteral{
+				global:    true,
+				index:     strI,
+				prefilter: prefilter,
+				verify:    e.ofMatcher(of),
+			})
+		case str.kind == literalCount:
+			count := countNodes[str]
+			plainI := addString(count.val.literal().plain())
+			e.positional[plainI] = struct{}{}
+			var prefilter [][]int
+			if _, positive := extractStrings(count); positive {
+				prefilter = [][]int{{plainI}}
+			}
+			e.verified = append(e.verified, verifiedLiteral{
+				field:     str.field,
+				index:     strI,
+				prefilter: prefilter,
+				count:     countMatcher(count, plainI),
+				verify: func(m *matchState) bool {
+					return count.comparison.compare(float64(m.counts[strI]), float64(count.count))
+				},
+			})
+		case str.kind == literalNear:
+			near := nearNodes[str]
+			plainI1, plainI2 := addString(near.val1.literal().plain()), addString(near.val2.literal().plain())
+			e.positional[plainI1], e.positional[plainI2] = struct{}{}, struct{}{}
+			e.verified = append(e.verified, verifiedLiteral{
+				field:     str.field,
+				index:     strI,
+				prefilter: [][]int{{plainI1, plainI2}},
+				verify:    nearMatcher(near, plainI1, plainI2),
+			})
+		case str.kind == literalThen:
+			then := thenNodes[str]
+			plainIndices := make([]int, len(then.vals))
+			for i, val := range then.vals {
+				plainIndices[i] = addString(val.literal().plain())
+				e.positional[plainIndices[i]] = struct{}{}
+			}
+			e.verified = append(e.verified, verifiedLiteral{
+				field:     str.field,
+				index:     strI,
+				prefilter: [][]int{plainIndices},
+				verify:    thenMatcher(then, plainIndices),
+			})
+		case str.kind == literalCondition:
+			// like a nodeOF, the literals of the condition are added first, so they are verified before it
+			condition := conditionNodes[str]
+			condStrings, positive := extractStrings(condition)
+			var prefilter [][]int
+			for _, condStr := range condStrings {
+				prefilter = append(prefilter, []int{addString(condStr)})
+			}
+			if !positive {
+				prefilter = nil
+			}
+			compiled := e.compileCondition(condition)
+			e.verified = append(e.verified, verifiedLiteral{
+				global:    true,
+				index:     strI,
+				prefilter: prefilter,
+				verify:    func(m *matchState) bool { return compiled(m.found) },
+			})
+		case str.kind == literalNum:
+			// numeric comparisons have no prefilter, they are verified with the value of their field after the
+			// Aho-Corasick automatons found all strings
+			e.verified = append(e.verified, verifiedLiteral{
+				field:  str.field,
+				index:  strI,
+				verify: numMatcher(numNodes[str]),
+			})
+		case str.anchor != anchorNone || str.word:
+			// anchored strings and words are verified with the positions of the plain string
+			plainI := addString(str.plain())
+			e.positional[plainI] = struct{}{}
+			e.verified = append(e.verified, verifiedLiteral{
+				field:     str.field,
+				index:     strI,
+				prefilter: [][]int{{plainI}},
+				verify:    positionMatcher(str, plainI),
+			})
+		case str.caseInsensitive:
+			e.fieldAutomatons(str.field).caseInsensitive.add(str.str, strI)
+		default:
+			e.fieldAutomatons(str.field).caseSensitive.add(str.str, strI)
 		}
-		for _, mp := range getAndPaths(root.SOP()) {
+		return strI
+	}
+	// compile adds the strings of the condition and its and-paths to the decision tree, or the condition to the set of
+	// the BDD, and returns the indices of the strings, the nodes that are verified as a whole have to be collected
+	// before their literals are added. Conditions with too many and-paths are verified as a whole, fallback is true
+	// for them.
+	compile := func(root node, tree *decisionTreeNode, set *bddConditions, output int) (strIndices []int, fallback bool) {
+		walk(root, func(n node) {
+			switch v := n.(type) {
+			case nodeOF:
+				ofNodes[v.literal()] = v
+			case nodeNEAR:
+				nearNodes[v.literal()] = v
+			case nodeTHEN:
+				thenNodes[v.literal()] = v
+			case nodeNUM:
+				numNodes[v.literal()] = v
+			case nodeCOUNT:
+				countNodes[v.literal()] = v
+				// the SOP conversion replaces negated counts with counts of the negated comparison
+				negated := v
+				negated.comparison = v.comparison.negate()
+				countNodes[negated.literal()] = negated
+			}
+		})
+		condStrings, positive := extractStrings(root)
+		for _, str := range condStrings {
+			strIndices = append(strIndices, addString(str))
+		}
+		if e.bdd != nil {
+			set.add(output, e.bdd.add(root, e.strings), strIndices, positive)
+			return
+		}
+		if countAndPaths(root, false, maxAndPaths) > maxAndPaths {
+			l := literal{kind: literalCondition, str: root.Condition()}
+			conditionNodes[l] = root
+			tree.add(andPathIndex{{i: addString(l)}}, output)
+			return strIndices, true
+		}
+		for _, mp := range simplifyAndPaths(getAndPaths(root.SOP())) {
 			mpi := make(andPathIndex, len(mp))
 			for i, ms := range mp {
-				mpi[i] = andStringIndex{not: ms.not, i: e.strings[ms.str]}
+				mpi[i] = andStringIndex{not: ms.not, i: addString(ms.literal)}
 			}
-			e.decisionTree.add(mpi, i)
+			tree.add(mpi, output)
 		}
+		return
 	}
-	if len(allStrings) > 0 {
-		e.ahoCorasick = ahocorasick.New(allStrings)
+	for i, root := range roots {
+		if root == nil {
+			continue // empty conditions and definitions
+		}
+		e.orig = append(e.orig, root)
+		strIndices, fallback := compile(root, e.decisionTree, e.bddConditions, i)
+		for _, strI := range strIndices {
+			e.mapping[strI] = append(e.mapping[strI], i)
+		}
+		if fallback {
+			e.fallbacks = append(e.fallbacks, i)
+		}
 	}
-	return &e, nil
+	for i, n := range named {
+		e.names = append(e.names, n.name)
+		if _, fallback := compile(n.root, e.namedDecisionTree, e.bddNamed, i); fallback {
+			e.fallbackNames = append(e.fallbackNames, n.name)
+		}
+	}
+	for _, f := range e.fields {
+		f.caseSensitive.build(e.positional)
+		f.caseInsensitive.build(e.positional)
+	}
+	return &e
+}
+
+// Fallbacks returns the indices of the conditions and the names of the named conditions that have more and-paths
+// than Options.MaxAndPaths allows, they are evaluated as a whole after the Aho-Corasick prefilter.
+func (e *Evalostic) Fallbacks() (conditions []int, names []string) {
+	return e.fallbacks, e.fallbackNames
 }
 
-// Match returns all indices of conditions that match the provided string
+func (e *Evalostic) fieldAutomatons(field string) *fieldAutomatons {
+	f, ok := e.fields[field]
+	if !ok {
+		f = new(fieldAutomatons)
+		e.fields[field] = f
+	}
+	return f
+}
+
+// Match returns all indices of conditions that match the provided string, named conditions are not included. Fields
+// are empty, so strings that are qualified with a field can not be found.
 func (e *Evalostic) Match(s string) (matchingConditions []int) {
-	var (
-		stringIndicesCaseInsensitive []int
-	)
-	if e.ahoCorasick != nil {
-		stringIndicesCaseInsensitive = e.ahoCorasick.Match(strings.ToLower(s))
+	return e.findOutputs(e.decisionTree, e.bddConditions, e.match(map[string]string{"": s}))
+}
+
+// MatchFields returns all indices of conditions that match the provided fields of a record, strings that are qualified
+// with a field, e.g. user:"root", are only searched in their field and unqualified strings are searched in all fields.
+// Missing fields are empty, a record without fields is matched like an empty string. The occurrences of counted
+// strings are summed over all fields that they are searched in.
+func (e *Evalostic) MatchFields(fields map[string]string) (matchingConditions []int) {
+	return e.findOutputs(e.decisionTree, e.bddConditions, e.match(fields))
+}
+
+// MatchNamed returns all indices of conditions and all names of named conditions that match the provided string,
+// the names are in order of their definition
+func (e *Evalostic) MatchNamed(s string) (matchingConditions []int, matchingNames []string) {
+	found := e.match(map[string]string{"": s})
+	for _, i := range e.findOutputs(e.namedDecisionTree, e.bddNamed, found) {
+		matchingNames = append(matchingNames, e.names[i])
 	}
-	decisionTreeEntries := make(map[decisionTreeEntry]struct{})
-	for _, si := range stringIndicesCaseInsensitive {
-		decisionTreeEntries[decisionTreeEntry{value: si}] = struct{}{}
+	return e.findOutputs(e.decisionTree, e.bddConditions, found), matchingNames
+}
+
+// match returns all strings and verified literals that can be found in the fields
+func (e *Evalostic) match(fields map[string]string) map[decisionTreeEntry]struct{} {
+	if len(fields) == 0 {
+		fields = map[string]string{"": ""} // the unqualified literals are verified with an empty string
+	}
+	found := make(map[decisionTreeEntry]struct{})
+	counts := make(map[int]int)
+	for field := range e.fields {
+		if _, ok := fields[field]; !ok && field != "" {
+			e.matchField(found, counts, field, "", false)
+		}
+	}
+	for field, value := range fields {
+		e.matchField(found, counts, field, value, true)
+	}
+	m := &matchState{found: found, counts: counts}
+	for _, verified := range e.verified {
+		if (verified.global || verified.count != nil) && verified.prefiltered(found) && verified.verify(m) {
+			found[decisionTreeEntry{value: verified.index}] = struct{}{}
+		}
+	}
+	return found
+}
+
+// matchField adds all strings and verified literals of the field that can be found in its value, unqualified
+// specifies if the unqualified strings and literals are also searched
+func (e *Evalostic) matchField(found map[decisionTreeEntry]struct{}, counts map[int]int, field, value string, unqualified bool) {
+	m := &matchState{
+		s:      value,
+		found:  found,
+		counts: counts,
+		ends:   make(map[int][]int),
+	}
+	e.find(m, field)
+	if unqualified && field != "" {
+		e.find(m, "") // unqualified strings can be found in all fields
+	}
+	for _, verified := range e.verified {
+		if verified.global || verified.field != field && (verified.field != "" || !unqualified) {
+			continue
+		}
+		if verified.count != nil {
+			if verified.prefiltered(found) {
+				counts[verified.index] += verified.count(m)
+			}
+		} else if verified.prefiltered(found) && verified.verify(m) {
+			found[decisionTreeEntry{value: verified.index}] = struct{}{}
+		}
+	}
+}
+
+// findOutputs returns the sorted and unique outputs of the decision tree, or of the set of the BDD if the backend is
+// BackendBDD
+func (e *Evalostic) findOutputs(tree *decisionTreeNode, set *bddConditions, found map[decisionTreeEntry]struct{}) (outputs []int) {
+	var all []int
+	if e.bdd != nil {
+		all = set.find(e.bdd, found)
+	} else {
+		all = tree.find(found)
 	}
 	unique := make(map[int]struct{})
-	for _, matchingCondition := range e.decisionTree.find(decisionTreeEntries) {
-		unique[matchingCondition] = struct{}{}
+	for _, output := range all {
+		unique[output] = struct{}{}
 	}
-	for matchingCondition := range unique {
-		matchingConditions = append(matchingConditions, matchingCondition)
+	for output := range unique {
+		outputs = append(outputs, output)
 	}
-	sort.Ints(matchingConditions)
+	sort.Ints(outputs)
 	return
 }
+
+// find applies the Aho-Corasick automatons of the field on the string of the match state
+func (e *Evalostic) find(m *matchState, field string) {
+	f, ok := e.fields[field]
+	if !ok {
+		return
+	}
+	f.caseSensitive.find(m, m.s, e.positional)
+	if !f.caseInsensitive.empty() {
+		f.caseInsensitive.find(m, m.lowered(), e.positional)
+	}
+}
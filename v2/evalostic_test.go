@@ -1,8 +1,12 @@
 package evalostic
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
+	"reflect"
+	"regexp"
 	"runtime"
 	"sort"
 	"strconv"
@@ -107,7 +111,7 @@ func (a OR) Match(str string) bool {
 type VALUE string // Case Sensitive
 
 func (v VALUE) Match(str string) bool {
-	return strings.Contains(strings.ToLower(str), strings.ToLower(string(v)))
+	return strings.Contains(str, string(v))
 }
 
 func (v VALUE) ToCondition() string {
@@ -278,6 +282,23 @@ func assertTrue(t *testing.T, b bool) {
 	}
 }
 
+// invalidConditions are conditions and the error of the first invalid condition in the format of ParseError.Error
+type invalidConditions struct {
+	conditions []string
+	err        string
+}
+
+// assertParseErrors checks that New reports the expected ParseError for each of the invalid conditions
+func assertParseErrors(t *testing.T, tests []invalidConditions) {
+	for _, tc := range tests {
+		_, err := New(tc.conditions)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.Error() != tc.err {
+			t.Errorf("%q: expected %s, got: %v", tc.conditions, tc.err, err)
+		}
+	}
+}
+
 func sameIntegers(a []int, b []int) bool {
 	if len(a) != len(b) {
 		return false
@@ -317,7 +338,553 @@ func TestEvalostic(t *testing.T) {
 	assertTrue(t, sameIntegers(e.Match("12"), []int{}))
 }
 
-func ExampleMatch() {
+func TestEvalostic_CaseSensitivity(t *testing.T) {
+	e, err := New([]string{
+		`"Foo"`,
+		`"Foo"i`,
+		`"foo" AND NOT "FOO"`,
+		`"BAR"i AND NOT "bar"`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match("Foo"), []int{0, 1}))
+	assertTrue(t, sameIntegers(e.Match("foo"), []int{1, 2}))
+	assertTrue(t, sameIntegers(e.Match("FOO"), []int{1}))
+	assertTrue(t, sameIntegers(e.Match("foo FOO"), []int{1}))
+	assertTrue(t, sameIntegers(e.Match("bar"), []int{}))
+	assertTrue(t, sameIntegers(e.Match("Bar"), []int{3}))
+	assertTrue(t, sameIntegers(e.Match("Bar bar"), []int{}))
+}
+
+func TestEvalostic_Regex(t *testing.T) {
+	e, err := New([]string{
+		`"login" AND /user=\w+@corp\.com/i`,
+		`/^\d+$/`,
+		`NOT /fo+/`,
+		`/a\/b/`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match("login user=Alice@CORP.com"), []int{0, 2}))
+	assertTrue(t, sameIntegers(e.Match("login user=@corp.com"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("user=bob@corp.com"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("12345"), []int{1, 2}))
+	assertTrue(t, sameIntegers(e.Match("foooo"), []int{}))
+	assertTrue(t, sameIntegers(e.Match("a/b"), []int{2, 3}))
+	_, err = New([]string{`/fo(o/`})
+	assertTrue(t, err != nil)
+}
+
+func TestEvalostic_Wildcard(t *testing.T) {
+	e, err := New([]string{
+		`w"cmd.exe*/c"`,
+		`w"CMD.EXE*/C"i AND NOT "whoami"`,
+		`"cmd.exe" AND "/c"`,
+		`w"a?c"`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match("cmd.exe /c whoami"), []int{0, 2}))
+	assertTrue(t, sameIntegers(e.Match("cmd.exe /c dir"), []int{0, 1, 2}))
+	assertTrue(t, sameIntegers(e.Match("/c cmd.exe"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("CMD.exe /C dir"), []int{1}))
+	assertTrue(t, sameIntegers(e.Match("abc"), []int{3}))
+	assertTrue(t, sameIntegers(e.Match("ac"), []int{}))
+}
+
+func TestEvalostic_Anchors(t *testing.T) {
+	e, err := New([]string{
+		`^"GET "`,
+		`".exe"$`,
+		`="admin"`,
+		`^"Admin"i$`,
+		`"a" AND NOT ^"a"`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match("GET /index.html"), []int{0}))
+	assertTrue(t, sameIntegers(e.Match("GET /cmd.exe"), []int{0, 1}))
+	assertTrue(t, sameIntegers(e.Match("POST /GET /cmd.exe?"), []int{}))
+	assertTrue(t, sameIntegers(e.Match("admin"), []int{2, 3}))
+	assertTrue(t, sameIntegers(e.Match("ADMIN"), []int{3}))
+	assertTrue(t, sameIntegers(e.Match("admin admin"), []int{}))
+	assertTrue(t, sameIntegers(e.Match("aa"), []int{}))
+	assertTrue(t, sameIntegers(e.Match("ba"), []int{4}))
+}
+
+func TestEvalostic_Words(t *testing.T) {
+	e, err := New([]string{
+		`"root"w`,
+		`"ROOT"iw`,
+		`^"su"w$`,
+		`"-c"w`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match("root"), []int{0, 1}))
+	assertTrue(t, sameIntegers(e.Match("user root logged in"), []int{0, 1}))
+	assertTrue(t, sameIntegers(e.Match("rootkit"), []int{}))
+	assertTrue(t, sameIntegers(e.Match("chroot"), []int{}))
+	assertTrue(t, sameIntegers(e.Match("chroot, Root!"), []int{1}))
+	assertTrue(t, sameIntegers(e.Match("root_dir"), []int{}))
+	assertTrue(t, sameIntegers(e.Match("rootä root"), []int{0, 1}))
+	assertTrue(t, sameIntegers(e.Match("su"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("sudo"), []int{}))
+	assertTrue(t, sameIntegers(e.Match("sh -c id"), []int{3}))
+	assertTrue(t, sameIntegers(e.Match("sh -cx id"), []int{}))
+}
+
+func TestEvalostic_Of(t *testing.T) {
+	e, err := New([]string{
+		`2 OF ("a", "b", "c", "d")`,
+		`NOT 2 OF ("a", "b", "c")`,
+		`"x" AND 1 OF (NOT "a", "b" AND "c")`,
+		`2 OF ("y", 1 OF ("a", "b"), /z+/)`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match(""), []int{1}))
+	assertTrue(t, sameIntegers(e.Match("a"), []int{1}))
+	assertTrue(t, sameIntegers(e.Match("ab"), []int{0}))
+	assertTrue(t, sameIntegers(e.Match("ad"), []int{0, 1}))
+	assertTrue(t, sameIntegers(e.Match("x"), []int{1, 2}))
+	assertTrue(t, sameIntegers(e.Match("xa"), []int{1}))
+	assertTrue(t, sameIntegers(e.Match("xabc"), []int{0, 2}))
+	assertTrue(t, sameIntegers(e.Match("yz"), []int{1, 3}))
+	assertTrue(t, sameIntegers(e.Match("az"), []int{1, 3}))
+	assertParseErrors(t, []invalidConditions{
+		{[]string{`2 OF ("a")`}, `condition 0, pos 1:1: threshold must be between 1 and 1, got: 2`},
+		{[]string{`0 OF ("a")`}, `condition 0, pos 1:1: threshold must be between 1 and 1, got: 0`},
+		{[]string{`2 OF ("a", )`}, `condition 0, pos 1:10: list ends with a comma, expected a list element`},
+		{[]string{`2 OF ("a",, "b")`}, `condition 0, pos 1:11: missing list element, expected a list element`},
+		{[]string{`2 OF "a"`}, `condition 0, pos 1:1: unexpected 2`},
+		{[]string{`"a", "b"`}, `condition 0, pos 1:4: unexpected ,`},
+	})
+}
+
+func TestEvalostic_Count(t *testing.T) {
+	e, err := New([]string{
+		`#"aa" >= 2`,
+		`#"aa"o >= 2`,
+		`NOT #"ab" > 1`,
+		`#"x" == 0 AND "y"`,
+		`#"Ab"iw != 2`,
+		`"z" AND #"aa" < 2`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match(""), []int{2, 4}))
+	assertTrue(t, sameIntegers(e.Match("aaa"), []int{1, 2, 4}))
+	assertTrue(t, sameIntegers(e.Match("aaaa"), []int{0, 1, 2, 4}))
+	assertTrue(t, sameIntegers(e.Match("abab"), []int{4}))
+	assertTrue(t, sameIntegers(e.Match("ab AB"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("ab ab ab"), []int{4}))
+	assertTrue(t, sameIntegers(e.Match("y"), []int{2, 3, 4}))
+	assertTrue(t, sameIntegers(e.Match("xy"), []int{2, 4}))
+	assertTrue(t, sameIntegers(e.Match("zaa"), []int{2, 4, 5}))
+	assertTrue(t, sameIntegers(e.Match("zaaaa"), []int{0, 1, 2, 4}))
+	assertParseErrors(t, []invalidConditions{
+		{[]string{`#"a"`}, `condition 0, pos 1:1: missing parameter for #, expected a string, a comparison and a number, e.g. #"foo" >= 3`},
+		{[]string{`#"a" >= `}, `condition 0, pos 1:1: missing parameter for #, expected a string, a comparison and a number, e.g. #"foo" >= 3`},
+		{[]string{`#"a" 3`}, `condition 0, pos 1:6: missing operator before 3, expected an operator, e.g. AND`},
+		{[]string{`# >= 3`}, `condition 0, pos 1:3: invalid parameter >= for #, expected a string, a comparison and a number, e.g. #"foo" >= 3`},
+		{[]string{`#/a/ >= 3`}, `condition 0, pos 1:2: invalid parameter /a/ for #, expected a string, a comparison and a number, e.g. #"foo" >= 3`},
+		{[]string{`"a"o`}, `condition 0, pos 1:1: modifier o is only allowed for counted strings`},
+		{[]string{`"a" >= 3`}, `condition 0, pos 1:5: unexpected >=`},
+	})
+}
+
+func TestEvalostic_Near(t *testing.T) {
+	e, err := New([]string{
+		`"foo" NEAR/3 "bar"`,
+		`"foo" NEAR/1W "bar"w`,
+		`NOT "foo" NEAR/0 "BAR"i`,
+		`"x" AND "a"w NEAR/2 "b"$`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match(""), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("foobar"), []int{0}))
+	assertTrue(t, sameIntegers(e.Match("bar foo"), []int{0, 1, 2}))
+	assertTrue(t, sameIntegers(e.Match("foo, and bar"), []int{1, 2}))
+	assertTrue(t, sameIntegers(e.Match("foo and more bar"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("foo and barbar"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("bar foo and more bar"), []int{0, 1, 2}))
+	assertTrue(t, sameIntegers(e.Match("Foo"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("foo"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("x a--b"), []int{2, 3}))
+	assertTrue(t, sameIntegers(e.Match("x a---b"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("xa-b"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("foobaz bar"), []int{1, 2}))
+	assertTrue(t, sameIntegers(e.Match("foobaz qux bar"), []int{2}))
+	// the positions of case insensitive strings are compared in the original string, whose Kelvin sign is lowercased
+	// to the shorter "k"
+	assertTrue(t, sameIntegers(e.Match("\u212A\u212Afooxxxxbar"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("\u212Afoobar"), []int{0}))
+	// only the closest occurrences are compared, so many occurrences of both strings are fast
+	e, err = New([]string{`"a" NEAR/0 "b"`, `"a" NEAR/1 "b"`, `"a" NEAR/0W "b"`})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match(strings.Repeat("a ", 100000)+strings.Repeat("b ", 100000)), []int{1, 2}))
+	assertParseErrors(t, []invalidConditions{
+		{[]string{`"foo" NEAR/3`}, `condition 0, pos 1:7: missing operand after NEAR/3, expected a string or a subcondition`},
+		{[]string{`NEAR/3 "foo"`}, `condition 0, pos 1:1: missing operand before NEAR/3, expected a string or a subcondition`},
+		{[]string{`"foo" NEAR/ "bar"`}, `condition 0, pos 1:11: unknown token /`},
+		{[]string{`/foo/ NEAR/3 "bar"`}, `condition 0, pos 1:7: NEAR/3 requires two strings, expected two strings, e.g. "foo" NEAR/5 "bar"`},
+		{[]string{`("foo" OR "baz") NEAR/3 "bar"`}, `condition 0, pos 1:18: NEAR/3 requires two strings, expected two strings, e.g. "foo" NEAR/5 "bar"`},
+	})
+}
+
+func TestEvalostic_Then(t *testing.T) {
+	e, err := New([]string{
+		`"a" THEN "b" THEN "c"`,
+		`"user" THEN/3 "login" THEN/1W "failed"i`,
+		`NOT "x" THEN "x"`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match(""), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("abc"), []int{0, 2}))
+	assertTrue(t, sameIntegers(e.Match("c b a"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("b a c b c"), []int{0, 2}))
+	assertTrue(t, sameIntegers(e.Match("x"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("xx"), nil))
+	assertTrue(t, sameIntegers(e.Match("user login FAILED"), []int{1, 2}))
+	assertTrue(t, sameIntegers(e.Match("user: login has FAILED"), []int{1, 2}))
+	assertTrue(t, sameIntegers(e.Match("user is login has FAILED"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("user: login has really failed"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("user login, login has failed"), []int{2}))
+	// the positions of case insensitive strings are compared in the original string
+	e, err = New([]string{`"foo" THEN/0 "BAR"i`})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match("\u212A\u212Afooxxxxbar"), nil))
+	assertTrue(t, sameIntegers(e.Match("\u212A\u212AfooBar"), []int{0}))
+	// only the closest reachable occurrences are compared, so many occurrences of all strings are fast
+	e, err = New([]string{`"a" THEN/0 "b"`, `"a" THEN/1 "b"`, `"b" THEN "a"`})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match(strings.Repeat("a ", 100000)+strings.Repeat("b ", 100000)), []int{1}))
+	assertParseErrors(t, []invalidConditions{
+		{[]string{`"a" THEN`}, `condition 0, pos 1:5: missing operand after THEN, expected a string or a subcondition`},
+		{[]string{`THEN "a"`}, `condition 0, pos 1:1: missing operand before THEN, expected a string or a subcondition`},
+		{[]string{`"a" THEN/ "b"`}, `condition 0, pos 1:9: unknown token /`},
+		{[]string{`"a" THEN ("b" OR "c")`}, `condition 0, pos 1:5: THEN requires strings, expected strings, e.g. "foo" THEN "bar"`},
+	})
+}
+
+func TestEvalostic_XorImplies(t *testing.T) {
+	e, err := New([]string{
+		`"a" XOR "b"`,
+		`"a" -> "b"`,
+		`"a" -> "b" -> "c"`,
+		`NOT ("a" XOR "b") AND "c"`,
+		`2 OF ("a" XOR "b", "c" IMPLIES "d", "e")`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match(""), []int{1, 2}))
+	assertTrue(t, sameIntegers(e.Match("a"), []int{0, 2, 4}))
+	assertTrue(t, sameIntegers(e.Match("b"), []int{0, 1, 2, 4}))
+	assertTrue(t, sameIntegers(e.Match("ab"), []int{1}))
+	assertTrue(t, sameIntegers(e.Match("abc"), []int{1, 2, 3}))
+	assertTrue(t, sameIntegers(e.Match("c"), []int{1, 2, 3}))
+	assertTrue(t, sameIntegers(e.Match("ce"), []int{1, 2, 3}))
+	assertTrue(t, sameIntegers(e.Match("e"), []int{1, 2, 4}))
+	assertParseErrors(t, []invalidConditions{
+		{[]string{`"a" XOR`}, `condition 0, pos 1:5: missing operand after XOR, expected a string or a subcondition`},
+		{[]string{`-> "a"`}, `condition 0, pos 1:1: missing operand before ->, expected a string or a subcondition`},
+		{[]string{`"a" -> -> "b"`}, `condition 0, pos 1:8: unexpected -> after ->, expected a string or a subcondition`},
+		{[]string{`"a" - "b"`}, `condition 0, pos 1:5: unknown token -`},
+	})
+}
+
+func TestEvalostic_Lists(t *testing.T) {
+	indicators := make([]string, 1000)
+	for i := range indicators {
+		indicators[i] = strconv.Quote(fmt.Sprintf("indicator%d.", i))
+	}
+	e, err := New([]string{
+		`ANY OF @shells AND "-c"`,
+		`@shells = ["bash", "zsh"i, w"*/sh "]`,
+		`ALL OF @shells`,
+		`2 OF ["x", "y", "z"] AND NOT ANY OF @shells`,
+		"",
+		`ANY OF [` + strings.Join(indicators, ", ") + `]`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match("bash -c"), []int{0}))
+	assertTrue(t, sameIntegers(e.Match("/bin/sh -c"), []int{0}))
+	assertTrue(t, sameIntegers(e.Match("ZSH -c"), []int{0}))
+	assertTrue(t, sameIntegers(e.Match("bash zsh /bin/sh "), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("xz"), []int{3}))
+	assertTrue(t, sameIntegers(e.Match("xz bash"), nil))
+	assertTrue(t, sameIntegers(e.Match("indicator999."), []int{5}))
+	assertTrue(t, sameIntegers(e.Match("indicator1000."), nil))
+	assertParseErrors(t, []invalidConditions{
+		{[]string{`ANY OF @undefined`}, `condition 0, pos 1:8: undefined list @undefined`},
+		{[]string{`@list = ["a"]`, `@list = ["b"]`}, `condition 1, pos 1:1: list @list is already defined`},
+		{[]string{`@list = "a"`}, `condition 0, pos 1:7: invalid definition of list @list, expected strings in brackets, e.g. ["foo", "bar"]`},
+		{[]string{`@list = ["a"] AND "b"`}, `condition 0, pos 1:7: invalid definition of list @list, expected strings in brackets, e.g. ["foo", "bar"]`},
+		{[]string{`ANY OF ["a" AND "b"]`}, `condition 0, pos 1:9: list in brackets may only contain strings, got: ("a" AND "b"), expected a string`},
+		{[]string{`ANY OF ["a", ["b"]]`}, `condition 0, pos 1:14: missing matching closing bracket, expected "]"`},
+		{[]string{`ANY OF ["a"`}, `condition 0, pos 1:8: missing matching closing bracket, expected "]"`},
+		{[]string{`"a" AND ["b"]`}, `condition 0, pos 1:9: unexpected list of strings, expected ANY OF, ALL OF or N OF before the list`},
+		{[]string{`ANY "a"`}, `condition 0, pos 1:1: unexpected ANY`},
+		{[]string{`@list`}, `condition 0, pos 1:1: undefined list @list`},
+	})
+}
+
+func TestEvalostic_NamedConditions(t *testing.T) {
+	e, err := New([]string{
+		`$shell AND "-c"`,
+		`$shell = "bash" OR "sh" OR $zsh`,
+		`$zsh = "zsh"i`,
+		`$remote = $shell AND "@" AND NOT "localhost"`,
+		`NOT $shell`,
+		`ANY OF ($remote, "ssh")`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, len(e.orig) == 3)
+	matching, names := e.MatchNamed("bash -c")
+	assertTrue(t, sameIntegers(matching, []int{0}))
+	assertTrue(t, reflect.DeepEqual(names, []string{"shell"}))
+	matching, names = e.MatchNamed("ZSH root@host")
+	assertTrue(t, sameIntegers(matching, []int{5}))
+	assertTrue(t, reflect.DeepEqual(names, []string{"shell", "zsh", "remote"}))
+	matching, names = e.MatchNamed("ssh root@localhost")
+	assertTrue(t, sameIntegers(matching, []int{5}))
+	assertTrue(t, reflect.DeepEqual(names, []string{"shell"}))
+	matching, names = e.MatchNamed("")
+	assertTrue(t, sameIntegers(matching, []int{4}))
+	assertTrue(t, names == nil)
+	assertTrue(t, sameIntegers(e.Match("zsh -c"), []int{0}))
+	var parseErr *ParseError
+	// the conditions of the cycle reference invalid conditions, the cycle itself is reported at the last one
+	_, err = NewWithOptions([]string{`$a = "x" OR $b`, `$b = NOT $c`, `$c = $a AND "y"`}, Options{SkipInvalid: true})
+	var multiErr *MultiError
+	assertTrue(t, errors.As(err, &multiErr) && sameIntegers(multiErr.Indices(), []int{0, 1, 2}))
+	parseErr = multiErr.Errors[2]
+	assertTrue(t, parseErr.Condition == 2 && parseErr.Column == 6)
+	assertTrue(t, parseErr.Message == "cycle in named conditions: $a -> $b -> $c -> $a")
+	// the anchor of a string is not mistaken for the assignment of a definition without spaces
+	e, err = New([]string{`$x ="admin"`, `$x AND "root"`, `$y="sudo"`, `$y OR ="su"`})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match("admin root"), []int{1}) && sameIntegers(e.Match("su"), []int{3}))
+	assertTrue(t, sameIntegers(e.Match("sudo -i"), []int{3}))
+	// references share the parsed named condition, so nested references do not grow exponentially while parsing
+	nested := []string{`$a0 = "x" OR "y"`}
+	for i := 1; i <= 40; i++ {
+		nested = append(nested, fmt.Sprintf("$a%d = $a%d AND $a%d", i, i-1, i-1))
+	}
+	_, named, errs := parseConditions(nested)
+	assertTrue(t, len(errs) == 0 && len(named) == 41)
+	_, err = New([]string{`$a = $a`})
+	assertTrue(t, errors.As(err, &parseErr) && parseErr.Message == "cycle in named conditions: $a -> $a")
+	assertParseErrors(t, []invalidConditions{
+		{[]string{`$undefined`}, `condition 0, pos 1:1: undefined condition $undefined`},
+		{[]string{`$a = "a"`, `$a = "b"`}, `condition 1, pos 1:1: condition $a is already defined`},
+		{[]string{`$a = `}, `condition 0, pos 1:1: empty condition, expected a string or a subcondition`},
+		{[]string{`$a = "a" AND`}, `condition 0, pos 1:10: missing operand after AND, expected a string or a subcondition`},
+		{[]string{`"a" AND $a = "b"`}, `condition 0, pos 1:9: undefined condition $a`},
+	})
+}
+
+func TestEvalostic_Fields(t *testing.T) {
+	e, err := New([]string{
+		`user:"root" AND "sudo"`,
+		`user:"root"w AND NOT host:/^srv\d+$/`,
+		`NOT user:"admin"`,
+		`#cmd:"-" >= 2 AND cmd:"rm" THEN cmd:"/"`,
+		`"android"`,
+		`2 OF (user:"x", host:"x", cmd:"x")`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"user": "root", "cmd": "sudo -s"}), []int{0, 1, 2}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"user": "sudo", "host": "root"}), []int{2}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"user": "root", "host": "srv12"}), []int{2}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"user": "root", "host": "srv12.local"}), []int{1, 2}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"user": "admin", "cmd": "rm -r -f /"}), []int{3}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"cmd": "rm -r /", "host": "android"}), []int{2, 4}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"cmd": "/ rm -rf", "user": "x", "host": "x"}), []int{2, 5}))
+	assertTrue(t, sameIntegers(e.MatchFields(nil), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("root sudo"), []int{2}))
+	assertTrue(t, sameIntegers(e.Match("android"), []int{2, 4}))
+	// unqualified literals are verified with an empty string if the record has no fields and counts are summed over
+	// all fields
+	e, err = New([]string{`#"x" == 0`, `/^$/`, `#"x" == 2`, `#user:"x" == 1`})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match(""), []int{0, 1}))
+	assertTrue(t, sameIntegers(e.MatchFields(nil), []int{0, 1}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"a": "x", "b": ""}), []int{1}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"user": "x", "b": "x"}), []int{2, 3}))
+	assertParseErrors(t, []invalidConditions{
+		{[]string{`user:`}, `condition 0, pos 1:6: field user must be followed by a string, expected a string`},
+		{[]string{`user:(`}, `condition 0, pos 1:6: field user must be followed by a string, expected a string`},
+		{[]string{`user:"a" NEAR/3 host:"b"`}, `condition 0, pos 1:10: NEAR/3 requires two strings of the same field`},
+		{[]string{`user:"a" THEN "b"`}, `condition 0, pos 1:10: THEN requires strings of the same field`},
+	})
+}
+
+func TestEvalostic_Numbers(t *testing.T) {
+	e, err := New([]string{
+		`status >= 500`,
+		`bytes < 1024 AND path:".php"`,
+		`duration BETWEEN 1 AND 5`,
+		`NOT status == 200`,
+		`"error" OR status BETWEEN 400 AND 499.5`,
+		`ANY OF (bytes > 1000000, duration >= 10)`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"status": "500", "bytes": "512"}), []int{0, 3}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"status": "200", "bytes": "512", "path": "/index.php"}), []int{1}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"status": " 404 ", "duration": "1"}), []int{2, 3, 4}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"status": "499.9", "duration": "5.01"}), []int{3}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"status": "n/a", "bytes": "2000000"}), []int{3, 5}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"msg": "error", "duration": "10"}), []int{3, 4, 5}))
+	assertTrue(t, sameIntegers(e.Match("status >= 500"), []int{3}))
+	// values are only numbers in the notation of numbers in conditions
+	for _, notNumber := range []string{"NaN", "Inf", "-Inf", "0x1f4", "0x1p9", "5e2", "+500", ".5", "500.", "1_000"} {
+		assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"status": notNumber}), []int{3}))
+	}
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"status": "-500.0"}), []int{3}))
+	assertParseErrors(t, []invalidConditions{
+		{[]string{`status`}, `condition 0, pos 1:1: unexpected status, expected a comparison, e.g. status >= 500 or status BETWEEN 1 AND 5`},
+		{[]string{`status >=`}, `condition 0, pos 1:1: comparison of field status requires a number, expected a number`},
+		{[]string{`status >= "500"`}, `condition 0, pos 1:11: comparison of field status requires a number, expected a number`},
+		{[]string{`status BETWEEN 1`}, `condition 0, pos 1:16: incomplete range of field status, expected AND after the lower bound`},
+		{[]string{`status BETWEEN 5 AND 1`}, `condition 0, pos 1:1: invalid range of field status: 5 is greater than 1`},
+		{[]string{`status BETWEEN 1 OR 5`}, `condition 0, pos 1:16: incomplete range of field status, expected AND after the lower bound`},
+		{[]string{`"a" BETWEEN 1 AND 5`}, `condition 0, pos 1:5: unexpected BETWEEN`},
+	})
+}
+
+func TestEvalostic_Comments(t *testing.T) {
+	e, err := New([]string{`
+		// failed logins of privileged users
+		"failed"i AND (
+			"root" /* the default admin */ OR
+			"admin" // legacy name
+		) AND NOT /https?:\/\/[^ ]*login/`,
+	})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match("Failed login of root"), []int{0}))
+	assertTrue(t, sameIntegers(e.Match("failed login of admin at http://host/login"), []int{}))
+	assertTrue(t, sameIntegers(e.Match("// failed login"), []int{}))
+	_, err = New([]string{`"foo" /* unterminated`})
+	assertTrue(t, err != nil)
+}
+
+func TestNewWithOptions(t *testing.T) {
+	conditions := []string{
+		`"foo" OR "bar"`,
+		`"foo" AND`,
+		`@list = ["a", "b" AND "c"]`,
+		`ANY OF @list`,
+		`$named = "baz" OR OR "qux"`,
+		`$named AND "foo"`,
+		`$valid = "baz"`,
+		`$valid AND "foo"`,
+		`"bar" ?`,
+	}
+	_, err := New(conditions)
+	var parseErr *ParseError
+	assertTrue(t, errors.As(err, &parseErr) && parseErr.Condition == 1)
+	e, err := NewWithOptions(conditions, Options{})
+	assertTrue(t, e == nil && err != nil)
+	e, err = NewWithOptions(conditions, Options{SkipInvalid: true})
+	var multiErr *MultiError
+	assertTrue(t, e != nil && errors.As(err, &multiErr))
+	assertTrue(t, sameIntegers(multiErr.Indices(), []int{1, 2, 3, 4, 5, 8}))
+	assertTrue(t, multiErr.Errors[2].Message == "invalid list @list")
+	assertTrue(t, multiErr.Errors[4].Message == "invalid condition $named")
+	assertTrue(t, errors.As(err, &parseErr) && parseErr.Condition == 1)
+	assertTrue(t, len(strings.Split(err.Error(), "\n")) == 6)
+	assertTrue(t, sameIntegers(e.Match("foo baz"), []int{0, 7}))
+	matching, names := e.MatchNamed("baz")
+	assertTrue(t, sameIntegers(matching, []int{}) && reflect.DeepEqual(names, []string{"valid"}))
+	e, err = NewWithOptions(conditions[:1], Options{SkipInvalid: true})
+	assertTrue(t, e != nil && err == nil)
+}
+
+func TestNewWithOptions_MaxAndPaths(t *testing.T) {
+	var clauses []string
+	for i := 0; i < 20; i++ {
+		clauses = append(clauses, fmt.Sprintf(`("a%d" OR "b%d")`, i, i))
+	}
+	conditions := []string{
+		strings.Join(clauses, " AND "),
+		`"foo" AND NOT ("bar" OR "baz")`,
+		`$named = NOT (NOT ` + strings.Join(clauses, " OR NOT ") + `)`,
+	}
+	e, err := New(conditions)
+	assertTrue(t, err == nil)
+	fallbacks, names := e.Fallbacks()
+	assertTrue(t, sameIntegers(fallbacks, []int{0}) && reflect.DeepEqual(names, []string{"named"}))
+	all := strings.Join(strings.Fields(strings.NewReplacer("(", "", ")", "", " OR", "", " AND", "", `"`, "").Replace(conditions[0])), " ")
+	matching, names := e.MatchNamed(all)
+	assertTrue(t, sameIntegers(matching, []int{0}) && reflect.DeepEqual(names, []string{"named"}))
+	matching, names = e.MatchNamed(strings.Replace(all, "a7 b7", "", 1))
+	assertTrue(t, sameIntegers(matching, []int{}) && len(names) == 0)
+	// conditions that are evaluated as a whole match the same strings as conditions in the decision tree
+	rand.Seed(0)
+	for i := 0; i < 100; i++ {
+		conditions = []string{randomCondition(4), randomCondition(4), `NOT (` + randomCondition(4) + `)`}
+		e1, err1 := New(conditions)
+		e2, err2 := NewWithOptions(conditions, Options{MaxAndPaths: 1})
+		assertTrue(t, err1 == nil && err2 == nil)
+		for _, condition := range conditions {
+			root, _ := parseCondition(condition)
+			assertTrue(t, countAndPaths(root, false, math.MaxInt32) == len(getAndPaths(root.SOP())))
+		}
+		for j := 0; j < 20; j++ {
+			var s string
+			for _, str := range regexp.MustCompile(`"[^"]*"`).FindAllString(strings.Join(conditions, " "), -1) {
+				if rand.Intn(2) == 0 {
+					s += str
+				}
+			}
+			if !sameIntegers(e1.Match(s), e2.Match(s)) {
+				t.Fatalf("%v: %s: %v != %v", conditions, s, e1.Match(s), e2.Match(s))
+			}
+		}
+	}
+}
+
+func TestNewWithOptions_Backend(t *testing.T) {
+	conditions := []string{
+		`"foo" AND NOT ("bar" OR "baz")`,
+		`NOT "foo" AND NOT "bar"`,
+		`/ba+r/i XOR 2 OF ("a", "b", "c") -> "qux" NEAR/3 "quux"`,
+		`user:"root" AND status >= 500 OR #"x" > 2`,
+		`$named = "foo" AND NOT "baz"`,
+	}
+	e, err := NewWithOptions(conditions, Options{Backend: BackendBDD})
+	assertTrue(t, err == nil)
+	for _, tc := range []struct {
+		s     string
+		match []int
+		names []string
+	}{
+		{"foo", []int{0, 2}, []string{"named"}},
+		{"foo bar", []int{2}, []string{"named"}},
+		{"baz", []int{1}, nil},
+		{"baaar a b", []int{1, 2}, nil},
+		{"a b qux x quux x x", []int{1, 2, 3}, nil},
+	} {
+		matching, names := e.MatchNamed(tc.s)
+		assertTrue(t, sameIntegers(matching, tc.match) && reflect.DeepEqual(names, tc.names))
+	}
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"user": "root", "status": "503"}), []int{1, 2, 3}))
+	// both backends match the same strings
+	rand.Seed(0)
+	for i := 0; i < 100; i++ {
+		conditions = []string{randomCondition(4), randomCondition(4), `NOT (` + randomCondition(4) + `)`}
+		e1, err1 := New(conditions)
+		e2, err2 := NewWithOptions(conditions, Options{Backend: BackendBDD})
+		assertTrue(t, err1 == nil && err2 == nil)
+		for j := 0; j < 20; j++ {
+			var s string
+			for _, str := range regexp.MustCompile(`"[^"]*"`).FindAllString(strings.Join(conditions, " "), -1) {
+				if rand.Intn(2) == 0 {
+					s += str
+				}
+			}
+			if !sameIntegers(e1.Match(s), e2.Match(s)) {
+				t.Fatalf("%v: %s: %v != %v", conditions, s, e1.Match(s), e2.Match(s))
+			}
+		}
+	}
+}
+
+func ExampleEvalostic_Match() {
 	e, err := New([]string{
 		`"foo" OR "bar"`,
 		`NOT "foo" AND ("bar" OR "baz")`,
@@ -338,7 +905,7 @@ func ExampleMatch() {
 	// []
 }
 
-func ExampleMatch_Negative() {
+func ExampleEvalostic_Match_negative() {
 	e, err := New([]string{
 		`NOT "foo" AND NOT "bar"`,
 		`NOT ("foo" AND "bar" AND "baz")`,
@@ -362,7 +929,7 @@ func ExampleMatch_Negative() {
 	// [0 1 2]
 }
 
-func ExampleMatch_CaseInsensitive() {
+func ExampleEvalostic_Match_caseInsensitive() {
 	e, err := New([]string{
 		`"FOO"i AND "bar"`,
 	})
@@ -375,8 +942,8 @@ func ExampleMatch_CaseInsensitive() {
 	fmt.Println(e.Match("FoO bar"))
 	// Output:
 	// [0]
-	// [0]
-	// [0]
+	// []
+	// []
 	// [0]
 }
 
@@ -455,7 +1022,7 @@ func BenchmarkNew(b *testing.B) {
 	}
 }
 
-func benchmarkNewN(b *testing.B, n int) {
+func benchmarkNewN(b *testing.B, n int, options Options) {
 	rand.Seed(0)
 	conds := make([]string, n)
 	for i := 0; i < n; i++ {
@@ -470,28 +1037,34 @@ func benchmarkNewN(b *testing.B, n int) {
 	b.ResetTimer()
 	var err error
 	for i := 0; i < b.N; i++ {
-		ev, err = New(conds)
+		ev, err = NewWithOptions(conds, options)
 		if err != nil {
 			b.Fatal(err)
 		}
 	}
 }
 
-func BenchmarkNew_10(b *testing.B)     { benchmarkNewN(b, 10) }
-func BenchmarkNew_100(b *testing.B)    { benchmarkNewN(b, 100) }
-func BenchmarkNew_1000(b *testing.B)   { benchmarkNewN(b, 1000) }
-func BenchmarkNew_10000(b *testing.B)  { benchmarkNewN(b, 10000) }
-func BenchmarkNew_100000(b *testing.B) { benchmarkNewN(b, 100000) }
+func BenchmarkNew_10(b *testing.B)     { benchmarkNewN(b, 10, Options{}) }
+func BenchmarkNew_100(b *testing.B)    { benchmarkNewN(b, 100, Options{}) }
+func BenchmarkNew_1000(b *testing.B)   { benchmarkNewN(b, 1000, Options{}) }
+func BenchmarkNew_10000(b *testing.B)  { benchmarkNewN(b, 10000, Options{}) }
+func BenchmarkNew_100000(b *testing.B) { benchmarkNewN(b, 100000, Options{}) }
+
+func BenchmarkNewBDD_10(b *testing.B)     { benchmarkNewN(b, 10, Options{Backend: BackendBDD}) }
+func BenchmarkNewBDD_100(b *testing.B)    { benchmarkNewN(b, 100, Options{Backend: BackendBDD}) }
+func BenchmarkNewBDD_1000(b *testing.B)   { benchmarkNewN(b, 1000, Options{Backend: BackendBDD}) }
+func BenchmarkNewBDD_10000(b *testing.B)  { benchmarkNewN(b, 10000, Options{Backend: BackendBDD}) }
+func BenchmarkNewBDD_100000(b *testing.B) { benchmarkNewN(b, 100000, Options{Backend: BackendBDD}) }
 
 var matches []int
 
-func benchmarkMatchN(b *testing.B, n int) {
+func benchmarkMatchN(b *testing.B, n int, options Options) {
 	rand.Seed(0)
 	conds := make([]string, n)
 	for i := 0; i < n; i++ {
 		conds[i] = randomCondition(3)
 	}
-	ev, err := New(conds)
+	ev, err := NewWithOptions(conds, options)
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -508,8 +1081,24 @@ func benchmarkMatchN(b *testing.B, n int) {
 	}
 }
 
-func BenchmarkEvalostic_Match_10(b *testing.B)     { benchmarkMatchN(b, 10) }
-func BenchmarkEvalostic_Match_100(b *testing.B)    { benchmarkMatchN(b, 100) }
-func BenchmarkEvalostic_Match_1000(b *testing.B)   { benchmarkMatchN(b, 1000) }
-func BenchmarkEvalostic_Match_10000(b *testing.B)  { benchmarkMatchN(b, 10000) }
-func BenchmarkEvalostic_Match_100000(b *testing.B) { benchmarkMatchN(b, 100000) }
+func BenchmarkEvalostic_Match_10(b *testing.B)     { benchmarkMatchN(b, 10, Options{}) }
+func BenchmarkEvalostic_Match_100(b *testing.B)    { benchmarkMatchN(b, 100, Options{}) }
+func BenchmarkEvalostic_Match_1000(b *testing.B)   { benchmarkMatchN(b, 1000, Options{}) }
+func BenchmarkEvalostic_Match_10000(b *testing.B)  { benchmarkMatchN(b, 10000, Options{}) }
+func BenchmarkEvalostic_Match_100000(b *testing.B) { benchmarkMatchN(b, 100000, Options{}) }
+
+func BenchmarkEvalostic_MatchBDD_10(b *testing.B) {
+	benchmarkMatchN(b, 10, Options{Backend: BackendBDD})
+}
+func BenchmarkEvalostic_MatchBDD_100(b *testing.B) {
+	benchmarkMatchN(b, 100, Options{Backend: BackendBDD})
+}
+func BenchmarkEvalostic_MatchBDD_1000(b *testing.B) {
+	benchmarkMatchN(b, 1000, Options{Backend: BackendBDD})
+}
+func BenchmarkEvalostic_MatchBDD_10000(b *testing.B) {
+	benchmarkMatchN(b, 10000, Options{Backend: BackendBDD})
+}
+func BenchmarkEvalostic_MatchBDD_100000(b *testing.B) {
+	benchmarkMatchN(b, 100000, Options{Backend: BackendBDD})
+}
@@ -6,16 +6,18 @@ import (
 )
 
 // ExportElasticSearchQuery exports the compiled query into an ElasticSearch query, e.g.
-// `"foo" OR "baz"` will be compiled to
+// `"foo" OR "baz"` will be compiled with the wildcardField "raw" to
 // {"bool":{"should":[{"wildcard":{"raw":{"case_insensitive":false,"value":"*foo*"}}},{"wildcard":{"raw":{"case_insensitive":false,"value":"*bar*"}}}]}}
+// Strings that are qualified with a field are searched in their field, all other strings in the wildcardField.
 func (e *Evalostic) ExportElasticSearchQuery(wildcardField string, useMatchPhrase bool) string {
 	b, _ := json.MarshalIndent(e.ExportElasticSearchQueryMap(wildcardField, useMatchPhrase), "", "  ")
 	return string(b)
 }
 
 // ExportElasticSearchQuery exports the compiled query into an ElasticSearch query, e.g.
-// `"foo" OR "baz"` will be compiled to
+// `"foo" OR "baz"` will be compiled with the wildcardField "raw" to
 // {"bool":{"should":[{"wildcard":{"raw":{"case_insensitive":false,"value":"foo"}}},{"wildcard":{"raw":{"case_insensitive":false,"value":"bar"}}}]}}
+// Strings that are qualified with a field are searched in their field, all other strings in the wildcardField.
 func (e *Evalostic) ExportElasticSearchQueryMap(wildcardField string, useMatchPhrase bool) map[string]interface{} {
 	var root node
 	for _, n := range e.orig {
@@ -25,34 +27,70 @@ func (e *Evalostic) ExportElasticSearchQueryMap(wildcardField string, useMatchPh
 			root = nodeOR{twoSubNodes{root, n}}
 		}
 	}
-	return nodeToElasticSearchQuery(root, useMatchPhrase)
+	return nodeToElasticSearchQuery(root, wildcardField, useMatchPhrase)
 }
 
-func nodeToElasticSearchQuery(n node, useMatchPhrase bool) map[string]interface{} {
+// elasticSearchField returns the field of the value, values without field are searched in the default field
+func (n valueNode) elasticSearchField(defaultField string) string {
+	if n.field == "" {
+		return defaultField
+	}
+	return n.field
+}
+
+func nodeToElasticSearchQuery(n node, wildcardField string, useMatchPhrase bool) map[string]interface{} {
 	switch v := n.(type) {
 	case nodeVAL:
-		return leafToElasticSearchQuery(v, useMatchPhrase)
+		return leafToElasticSearchQuery(v, wildcardField, useMatchPhrase)
+	case nodeREGEX:
+		return regexToElasticSearchQuery(v, wildcardField)
+	case nodeWILDCARD:
+		return wildcardToElasticSearchQuery(v, wildcardField)
+	case nodeOF:
+		return ofToElasticSearchQuery(v, wildcardField, useMatchPhrase)
+	case nodeCOUNT:
+		return countToElasticSearchQuery(v, wildcardField, useMatchPhrase)
+	case nodeNEAR:
+		return nearToElasticSearchQuery(v, wildcardField, useMatchPhrase)
+	case nodeTHEN:
+		return thenToElasticSearchQuery(v, wildcardField)
+	case nodeNUM:
+		return numToElasticSearchQuery(v)
+	case nodeXOR:
+		return nodeToElasticSearchQuery(nodeOR{twoSubNodes{
+			nodeAND{twoSubNodes{v.node1, nodeNOT{oneSubNode{v.node2}}}},
+			nodeAND{twoSubNodes{nodeNOT{oneSubNode{v.node1}}, v.node2}},
+		}}, wildcardField, useMatchPhrase)
+	case nodeIMPLIES:
+		return nodeToElasticSearchQuery(nodeOR{twoSubNodes{nodeNOT{oneSubNode{v.node1}}, v.node2}}, wildcardField, useMatchPhrase)
 	case nodeNOT:
-		return notToElasticSearchQuery(v, useMatchPhrase)
+		return notToElasticSearchQuery(v, wildcardField, useMatchPhrase)
 	case nodeOR:
-		return orToElasticSearchQuery(v, useMatchPhrase)
+		return orToElasticSearchQuery(v, wildcardField, useMatchPhrase)
 	case nodeAND:
-		return andToElasticSearchQuery(v, useMatchPhrase)
+		return andToElasticSearchQuery(v, wildcardField, useMatchPhrase)
 	default:
 		return nil
 	}
 }
 
-var wildcardReplacer = strings.NewReplacer("\\", "\\\\", "*", "\\*", "?", "\\?")
+var (
+	wildcardReplacer        = strings.NewReplacer("\\", "\\\\", "*", "\\*", "?", "\\?")
+	wildcardPatternReplacer = strings.NewReplacer("\\", "\\\\") // keeps the wildcards of wildcard patterns
+)
 
-func notToElasticSearchQuery(n nodeNOT, useMatchPhrase bool) map[string]interface{} {
+func notToElasticSearchQuery(n nodeNOT, wildcardField string, useMatchPhrase bool) map[string]interface{} {
 	if not, ok := n.node.(nodeNOT); ok { // check for double negation
-		return nodeToElasticSearchQuery(not.node, useMatchPhrase)
+		return nodeToElasticSearchQuery(not.node, wildcardField, useMatchPhrase)
+	}
+	if count, ok := n.node.(nodeCOUNT); ok { // the negation of the approximated count is not an approximation anymore
+		count.comparison = count.comparison.negate()
+		return countToElasticSearchQuery(count, wildcardField, useMatchPhrase)
 	}
 	return map[string]interface{}{
 		"bool": map[string]interface{}{
 			"must_not": []map[string]interface{}{
-				nodeToElasticSearchQuery(n.node, useMatchPhrase),
+				nodeToElasticSearchQuery(n.node, wildcardField, useMatchPhrase),
 			},
 		},
 	}
@@ -88,10 +126,10 @@ func flattenAnd(n nodeAND) []node {
 	return nodes
 }
 
-func orToElasticSearchQuery(n nodeOR, useMatchPhrase bool) map[string]interface{} {
+func orToElasticSearchQuery(n nodeOR, wildcardField string, useMatchPhrase bool) map[string]interface{} {
 	var should []map[string]interface{}
 	for _, node := range flattenOr(n) {
-		should = append(should, nodeToElasticSearchQuery(node, useMatchPhrase))
+		should = append(should, nodeToElasticSearchQuery(node, wildcardField, useMatchPhrase))
 	}
 	return map[string]interface{}{
 		"bool": map[string]interface{}{
@@ -100,10 +138,128 @@ func orToElasticSearchQuery(n nodeOR, useMatchPhrase bool) map[string]interface{
 	}
 }
 
-func andToElasticSearchQuery(n nodeAND, useMatchPhrase bool) map[string]interface{} {
+func ofToElasticSearchQuery(n nodeOF, wildcardField string, useMatchPhrase bool) map[string]interface{} {
+	should := make([]map[string]interface{}, len(n.nodes))
+	for i, node := range n.nodes {
+		should[i] = nodeToElasticSearchQuery(node, wildcardField, useMatchPhrase)
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should":               should,
+			"minimum_should_match": n.min,
+		},
+	}
+}
+
+// countToElasticSearchQuery exports an approximation of the count, ElasticSearch queries can not count the occurrences
+// of a string without scripts. The query only checks that the string occurs, or matches all documents if the count
+// is also satisfied by zero occurrences.
+func countToElasticSearchQuery(n nodeCOUNT, wildcardField string, useMatchPhrase bool) map[string]interface{} {
+	if n.comparison.compare(0, float64(n.count)) {
+		return map[string]interface{}{
+			"match_all": map[string]interface{}{},
+		}
+	}
+	return leafToElasticSearchQuery(n.val, wildcardField, useMatchPhrase)
+}
+
+// nearToElasticSearchQuery exports the distance in words as intervals query, the distance in characters can not be
+// expressed in ElasticSearch queries, so only both strings are required
+func nearToElasticSearchQuery(n nodeNEAR, wildcardField string, useMatchPhrase bool) map[string]interface{} {
+	if !n.gap.words {
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must": []map[string]interface{}{
+					leafToElasticSearchQuery(n.val1, wildcardField, useMatchPhrase),
+					leafToElasticSearchQuery(n.val2, wildcardField, useMatchPhrase),
+				},
+			},
+		}
+	}
+	return map[string]interface{}{
+		"intervals": map[string]interface{}{
+			n.val1.elasticSearchField(wildcardField): allOfIntervals(false, n.gap, matchInterval(n.val1), matchInterval(n.val2)),
+		},
+	}
+}
+
+// thenToElasticSearchQuery exports the sequence as nested ordered intervals queries, so that every gap can have its
+// own maximum. Gaps in characters can not be expressed in ElasticSearch queries and are not limited.
+func thenToElasticSearchQuery(n nodeTHEN, wildcardField string) map[string]interface{} {
+	rule := matchInterval(n.vals[0])
+	for i, val := range n.vals[1:] {
+		rule = allOfIntervals(true, n.gaps[i], rule, matchInterval(val))
+	}
+	return map[string]interface{}{
+		"intervals": map[string]interface{}{
+			n.vals[0].elasticSearchField(wildcardField): rule,
+		},
+	}
+}
+
+// comparisonRange maps the comparisons to the parameters of range queries
+var comparisonRange = map[comparison]string{
+	comparisonGE: "gte",
+	comparisonGT: "gt",
+	comparisonLE: "lte",
+	comparisonLT: "lt",
+}
+
+// numToElasticSearchQuery exports the comparison as range query, values that are not equal are either less or greater
+func numToElasticSearchQuery(n nodeNUM) map[string]interface{} {
+	rangeQuery := func(bounds map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"range": map[string]interface{}{
+				n.field: bounds,
+			},
+		}
+	}
+	if n.between {
+		return rangeQuery(map[string]interface{}{"gte": n.value, "lte": n.max})
+	}
+	switch n.comparison {
+	case comparisonEQ:
+		return rangeQuery(map[string]interface{}{"gte": n.value, "lte": n.value})
+	case comparisonNE:
+		return map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": []map[string]interface{}{
+					rangeQuery(map[string]interface{}{"lt": n.value}),
+					rangeQuery(map[string]interface{}{"gt": n.value}),
+				},
+			},
+		}
+	}
+	return rangeQuery(map[string]interface{}{comparisonRange[n.comparison]: n.value})
+}
+
+func matchInterval(n nodeVAL) map[string]interface{} {
+	return map[string]interface{}{
+		"match": map[string]interface{}{
+			"query":   n.nodeValue,
+			"ordered": true,
+		},
+	}
+}
+
+func allOfIntervals(ordered bool, g gap, rules ...map[string]interface{}) map[string]interface{} {
+	maxGaps := -1
+	if g.words {
+		maxGaps = g.distance
+	}
+	return map[string]interface{}{
+		"all_of": map[string]interface{}{
+			"ordered":   ordered,
+			"max_gaps":  maxGaps,
+			"intervals": rules,
+		},
+	}
+}
+
+func andToElasticSearchQuery(n nodeAND, wildcardField string, useMatchPhrase bool) map[string]interface{} {
 	var must []map[string]interface{}
 	for _, node := range flattenAnd(n) {
-		must = append(must, nodeToElasticSearchQuery(node, useMatchPhrase))
+		must = append(must, nodeToElasticSearchQuery(node, wildcardField, useMatchPhrase))
 	}
 	return map[string]interface{}{
 		"bool": map[string]interface{}{
@@ -112,19 +268,72 @@ func andToElasticSearchQuery(n nodeAND, useMatchPhrase bool) map[string]interfac
 	}
 }
 
-func leafToElasticSearchQuery(n nodeVAL, useMatchPhrase bool) map[string]interface{} {
-	if useMatchPhrase {
+func leafToElasticSearchQuery(n nodeVAL, wildcardField string, useMatchPhrase bool) map[string]interface{} {
+	switch n.anchor {
+	case anchorStart:
+		return map[string]interface{}{
+			"prefix": map[string]interface{}{
+				n.elasticSearchField(wildcardField): map[string]interface{}{
+					"value":            n.nodeValue,
+					"case_insensitive": n.caseInsensitive,
+				},
+			},
+		}
+	case anchorEnd:
+		return map[string]interface{}{
+			"wildcard": map[string]interface{}{
+				n.elasticSearchField(wildcardField): map[string]interface{}{
+					"value":            "*" + wildcardReplacer.Replace(n.nodeValue),
+					"case_insensitive": n.caseInsensitive,
+				},
+			},
+		}
+	case anchorEqual:
+		return map[string]interface{}{
+			"term": map[string]interface{}{
+				n.elasticSearchField(wildcardField): map[string]interface{}{
+					"value":            n.nodeValue,
+					"case_insensitive": n.caseInsensitive,
+				},
+			},
+		}
+	}
+	if useMatchPhrase || n.word { // wildcard queries can not check word boundaries
 		return map[string]interface{}{
 			"match_phrase": map[string]interface{}{
-				"raw": n.nodeValue,
+				n.elasticSearchField(wildcardField): n.nodeValue,
 			},
 		}
 	}
 	return map[string]interface{}{
 		"wildcard": map[string]interface{}{
-			"raw": map[string]interface{}{
+			n.elasticSearchField(wildcardField): map[string]interface{}{
 				"value":            "*" + wildcardReplacer.Replace(n.nodeValue) + "*",
-				"case_insensitive": true,
+				"case_insensitive": n.caseInsensitive,
+			},
+		},
+	}
+}
+
+func wildcardToElasticSearchQuery(n nodeWILDCARD, wildcardField string) map[string]interface{} {
+	return map[string]interface{}{
+		"wildcard": map[string]interface{}{
+			n.elasticSearchField(wildcardField): map[string]interface{}{
+				"value":            "*" + wildcardPatternReplacer.Replace(n.nodeValue) + "*",
+				"case_insensitive": n.caseInsensitive,
+			},
+		},
+	}
+}
+
+// regexToElasticSearchQuery exports the regex as regexp query, ElasticSearch regexes are always anchored and do not
+// support all features of Go regexes, e.g. Perl character classes like \w.
+func regexToElasticSearchQuery(n nodeREGEX, wildcardField string) map[string]interface{} {
+	return map[string]interface{}{
+		"regexp": map[string]interface{}{
+			n.elasticSearchField(wildcardField): map[string]interface{}{
+				"value":            ".*(" + n.nodeValue + ").*",
+				"case_insensitive": n.caseInsensitive,
 			},
 		},
 	}
@@ -16,16 +16,19 @@ func TestExportElasticSearchQueryMap(t *testing.T) {
 			},
 		}
 	}
-	wildcard := func(s string) map[string]interface{} {
+	wildcardCase := func(s string, caseInsensitive bool) map[string]interface{} {
 		return map[string]interface{}{
 			"wildcard": map[string]interface{}{
 				"raw": map[string]interface{}{
-					"case_insensitive": true,
+					"case_insensitive": caseInsensitive,
 					"value":            "*" + s + "*",
 				},
 			},
 		}
 	}
+	wildcard := func(s string) map[string]interface{} {
+		return wildcardCase(s, false)
+	}
 	and := func(must ...map[string]interface{}) map[string]interface{} {
 		return map[string]interface{}{
 			"bool": map[string]interface{}{
@@ -63,12 +66,183 @@ func TestExportElasticSearchQueryMap(t *testing.T) {
 			conditions:     []string{`"a"`},
 			expectedResult: wildcard("a"),
 		},
+		{
+			name:           "simple case insensitive",
+			conditions:     []string{`"Ab"i`},
+			expectedResult: wildcardCase("Ab", true),
+		},
+		{
+			name:       "regex",
+			conditions: []string{`/a(b|c)/i`},
+			expectedResult: map[string]interface{}{
+				"regexp": map[string]interface{}{
+					"raw": map[string]interface{}{
+						"case_insensitive": true,
+						"value":            ".*(a(b|c)).*",
+					},
+				},
+			},
+		},
+		{
+			name:           "escaped wildcards in strings",
+			conditions:     []string{`"a*b?\\c"`},
+			expectedResult: wildcard(`a\*b\?\\c`),
+		},
+		{
+			name:           "wildcard pattern",
+			conditions:     []string{`w"a*b?\\c"i`},
+			expectedResult: wildcardCase(`a*b?\\c`, true),
+		},
+		{
+			name:       "anchors",
+			conditions: []string{`^"a*"i`, `"b*"$`, `="c*"`},
+			expectedResult: or(
+				map[string]interface{}{
+					"prefix": map[string]interface{}{
+						"raw": map[string]interface{}{
+							"case_insensitive": true,
+							"value":            "a*",
+						},
+					},
+				},
+				map[string]interface{}{
+					"wildcard": map[string]interface{}{
+						"raw": map[string]interface{}{
+							"case_insensitive": false,
+							"value":            `*b\*`,
+						},
+					},
+				},
+				map[string]interface{}{
+					"term": map[string]interface{}{
+						"raw": map[string]interface{}{
+							"case_insensitive": false,
+							"value":            "c*",
+						},
+					},
+				},
+			),
+		},
 		{
 			name:           "simple match phrase",
 			useMatchPhrase: true,
 			conditions:     []string{`"a"`},
 			expectedResult: matchPhrase("a"),
 		},
+		{
+			name:           "word",
+			conditions:     []string{`"a"w AND "b"`},
+			expectedResult: and(matchPhrase("a"), wildcard("b")),
+		},
+		{
+			name:       "of",
+			conditions: []string{`2 OF ("a", NOT "b", "c" OR "d")`},
+			expectedResult: map[string]interface{}{
+				"bool": map[string]interface{}{
+					"should":               []map[string]interface{}{wildcard("a"), not(wildcard("b")), or(wildcard("c"), wildcard("d"))},
+					"minimum_should_match": 2,
+				},
+			},
+		},
+		{
+			name:           "count",
+			conditions:     []string{`#"a" >= 3 AND NOT #"b"i > 2`},
+			expectedResult: and(wildcard("a"), map[string]interface{}{"match_all": map[string]interface{}{}}),
+		},
+		{
+			name:           "near",
+			conditions:     []string{`"a" NEAR/3 "b"`},
+			expectedResult: and(wildcard("a"), wildcard("b")),
+		},
+		{
+			name:       "near words",
+			conditions: []string{`"a b" NEAR/3W "c"`},
+			expectedResult: map[string]interface{}{
+				"intervals": map[string]interface{}{
+					"raw": map[string]interface{}{
+						"all_of": map[string]interface{}{
+							"ordered":  false,
+							"max_gaps": 3,
+							"intervals": []map[string]interface{}{
+								{"match": map[string]interface{}{"query": "a b", "ordered": true}},
+								{"match": map[string]interface{}{"query": "c", "ordered": true}},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:       "then",
+			conditions: []string{`"a" THEN/2W "b" THEN "c"`},
+			expectedResult: map[string]interface{}{
+				"intervals": map[string]interface{}{
+					"raw": map[string]interface{}{
+						"all_of": map[string]interface{}{
+							"ordered":  true,
+							"max_gaps": -1,
+							"intervals": []map[string]interface{}{
+								{
+									"all_of": map[string]interface{}{
+										"ordered":  true,
+										"max_gaps": 2,
+										"intervals": []map[string]interface{}{
+											{"match": map[string]interface{}{"query": "a", "ordered": true}},
+											{"match": map[string]interface{}{"query": "b", "ordered": true}},
+										},
+									},
+								},
+								{"match": map[string]interface{}{"query": "c", "ordered": true}},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:           "xor",
+			conditions:     []string{`"a" XOR "b"`},
+			expectedResult: or(and(wildcard("a"), not(wildcard("b"))), and(not(wildcard("a")), wildcard("b"))),
+		},
+		{
+			name:           "implies",
+			conditions:     []string{`"a" -> "b"`},
+			expectedResult: or(not(wildcard("a")), wildcard("b")),
+		},
+		{
+			name:       "list",
+			conditions: []string{`@list = ["a", "b"]`, `ALL OF @list`},
+			expectedResult: map[string]interface{}{
+				"bool": map[string]interface{}{
+					"should":               []map[string]interface{}{wildcard("a"), wildcard("b")},
+					"minimum_should_match": 2,
+				},
+			},
+		},
+		{
+			name:       "field",
+			conditions: []string{`user:"a"i AND "b"`},
+			expectedResult: and(map[string]interface{}{
+				"wildcard": map[string]interface{}{
+					"user": map[string]interface{}{
+						"case_insensitive": true,
+						"value":            "*a*",
+					},
+				},
+			}, wildcard("b")),
+		},
+		{
+			name:       "numbers",
+			conditions: []string{`status >= 500 OR duration BETWEEN 1 AND 5.5 OR bytes != 0`},
+			expectedResult: or(
+				map[string]interface{}{"range": map[string]interface{}{"status": map[string]interface{}{"gte": 500.0}}},
+				map[string]interface{}{"range": map[string]interface{}{"duration": map[string]interface{}{"gte": 1.0, "lte": 5.5}}},
+				map[string]interface{}{"bool": map[string]interface{}{"should": []map[string]interface{}{
+					{"range": map[string]interface{}{"bytes": map[string]interface{}{"lt": 0.0}}},
+					{"range": map[string]interface{}{"bytes": map[string]interface{}{"gt": 0.0}}},
+				}}},
+			),
+		},
 		{
 			name:           "and",
 			conditions:     []string{`"a" AND "b"`},
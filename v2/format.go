@@ -0,0 +1,284 @@
+package evalostic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	formatWidth  = 80     // maximum length of a line before OR lists and thresholds are split into several lines
+	formatIndent = "    " // indentation of the lines in parentheses
+)
+
+// precedence of the operators, an operand needs parentheses if its operator has a lower precedence than required
+const (
+	precedenceRoot = iota // the whole condition
+	precedenceList        // an element of a threshold
+	precedenceIMPLIES
+	precedenceOR
+	precedenceXOR
+	precedenceAND
+	precedenceNOT
+	precedenceAtom
+)
+
+// Format parses the condition and returns it in a canonical notation: keywords are upper case, strings are quoted
+// the same way, parentheses are only kept where they are required and OR lists and thresholds that do not fit into
+// a line are split into one operand per line. Thresholds are written as ANY OF or ALL OF where possible. Definitions
+// of named lists and named conditions are formatted as well, references are kept as they are written but they are
+// not resolved, so errors that depend on the referenced definitions are not reported. Conditions with comments are
+// rejected, because the comments would be lost.
+func Format(condition string) (string, error) {
+	return rewrite(condition, "format", nil)
+}
+
+// rewrite formats the condition after the transformation of its parsed node, action describes the rewrite in errors
+func rewrite(condition string, action string, transform func(n node) node) (string, error) {
+	if condition == "" {
+		return "", nil
+	}
+	formatted, err := format(condition, transform)
+	if err != nil {
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			parseErr = &ParseError{Message: err.Error()}
+		}
+		parseErr.source = condition
+		return "", fmt.Errorf("could not %s condition: %w", action, parseErr)
+	}
+	return formatted, nil
+}
+
+// firstComment returns the first comment of the tokenized condition as a token, comments are the only text between
+// the tokens that is not whitespace
+func firstComment(condition string, t []token) (token, bool) {
+	end := position{line: 1, column: 1}
+	for i := 0; i <= len(t); i++ {
+		next := len(condition)
+		if i < len(t) {
+			next = t[i].pos.offset
+		}
+		gap := condition[end.offset:next]
+		if comment := strings.TrimLeftFunc(gap, unicode.IsSpace); comment != "" {
+			return token{text: comment[:2], pos: end.advance(gap[:len(gap)-len(comment)])}, true
+		}
+		if i < len(t) {
+			end = t[i].pos.advance(t[i].text)
+		}
+	}
+	return token{}, false
+}
+
+// format parses and formats the condition, transform is applied to the node of the condition unless it is nil
+func format(condition string, transform func(n node) node) (string, error) {
+	t, err := tokenize(condition)
+	if err != nil {
+		return "", err
+	}
+	if c, ok := firstComment(condition, t); ok {
+		return "", errorAt(c, "", "comment would be removed")
+	}
+	f := formatter{width: formatWidth, placeholder: placeholder(t)}
+	if len(t) >= 2 && t[0].tokenType == tokenTypeLIST && t[1].tokenType == tokenTypeASSIGN {
+		list, err := parseList(t)
+		if err != nil {
+			return "", err
+		}
+		elems := make([]string, len(list.nodes))
+		for i, elem := range list.nodes {
+			elems[i] = elem.Condition()
+		}
+		return f.list("@"+t[0].matched+" = [", elems, "]", ""), nil
+	}
+	var prefix string
+	if len(t) >= 2 && t[0].tokenType == tokenTypeREF && t[1].tokenType == tokenTypeASSIGN {
+		prefix, t = "$"+t[0].matched+" = ", t[2:]
+	}
+	t, err = replaceReferences(t, f.placeholder)
+	if err != nil {
+		return "", err
+	}
+	root, err := parse(t)
+	if err != nil {
+		return "", err
+	}
+	if transform != nil {
+		root = transform(root)
+	}
+	return prefix + f.format(root, precedenceRoot, ""), nil
+}
+
+// placeholder returns a prefix that no string of the tokens contains
+func placeholder(tokens []token) string {
+	prefix := "\x00"
+	for _, t := range tokens {
+		for strings.Contains(t.matched, prefix) {
+			prefix += "\x00"
+		}
+	}
+	return prefix
+}
+
+// replaceReferences replaces the references of named conditions and named lists with strings in parentheses, so that
+// the condition can be parsed without the definitions. The strings consist of the placeholder and the reference.
+func replaceReferences(tokens []token, placeholder string) ([]token, error) {
+	var res []token
+	for i, t := range tokens {
+		var reference string
+		switch {
+		case t.tokenType == tokenTypeREF:
+			reference = "$" + t.matched
+		case t.tokenType == tokenTypeLIST && i >= 2 && tokens[i-1].tokenType == tokenTypeOF && isQuantifier(tokens[i-2]):
+			// the threshold is part of the placeholder, because the length of the list is unknown
+			quantifier := tokens[i-2]
+			threshold := strings.ToUpper(quantifier.matched)
+			if quantifier.tokenType == tokenTypeNUM {
+				if n, err := strconv.Atoi(quantifier.matched); err != nil || n < 1 {
+					return nil, errorAt(quantifier, "", "invalid threshold %s", quantifier.matched)
+				}
+			}
+			res = res[:len(res)-2]
+			reference = threshold + " OF @" + t.matched
+			t.pos, t.text = quantifier.pos, quantifier.text
+		default:
+			res = append(res, t)
+			continue
+		}
+		res = append(res,
+			token{tokenType: tokenTypeLPAR, matched: "(", text: t.text, pos: t.pos},
+			token{tokenType: tokenTypeVAL, matched: placeholder + reference, text: t.text, pos: t.pos},
+			token{tokenType: tokenTypeRPAR, matched: ")", text: t.text, pos: t.pos},
+		)
+	}
+	return res, nil
+}
+
+// formatter formats conditions, lines that are longer than width are split if possible, they are never split if
+// width is negative. Strings that start with the placeholder are references.
+type formatter struct {
+	width       int
+	placeholder string
+}
+
+// format returns the condition of the node, prec is the minimum precedence of the node without parentheses and
+// indent is the indentation of the line that contains the node
+func (f formatter) format(n node, prec int, indent string) string {
+	switch v := n.(type) {
+	case nodeOR:
+		return f.chain(n, flattenOr(v), "OR", precedenceOR, prec, indent)
+	case nodeXOR:
+		return f.chain(n, flattenXor(v), "XOR", precedenceXOR, prec, indent)
+	case nodeAND:
+		return f.chain(n, flattenAnd(v), "AND", precedenceAND, prec, indent)
+	case nodeIMPLIES:
+		// IMPLIES is right associative
+		s := f.format(v.node1, precedenceIMPLIES+1, indent) + " IMPLIES " + f.format(v.node2, precedenceIMPLIES, indent)
+		return parenthesize(s, precedenceIMPLIES < prec)
+	case nodeNOT:
+		// a NOT requires parentheses around another NOT
+		return parenthesize("NOT "+f.format(v.node, precedenceAtom, indent), precedenceNOT < prec)
+	case nodeOF:
+		elems := make([]string, len(v.nodes))
+		for i, subNode := range v.nodes {
+			elems[i] = f.format(subNode, precedenceList, indent+formatIndent)
+		}
+		threshold := strconv.Itoa(v.min)
+		switch v.min {
+		case 1:
+			threshold = "ANY"
+		case len(v.nodes):
+			threshold = "ALL"
+		}
+		return f.list(threshold+" OF (", elems, ")", indent)
+	case nodeVAL:
+		return f.val(v)
+	case nodeNEAR:
+		return fmt.Sprintf("%s NEAR%s %s", f.val(v.val1), v.gap, f.val(v.val2))
+	case nodeTHEN:
+		var b strings.Builder
+		for i, val := range v.vals {
+			if i > 0 {
+				fmt.Fprintf(&b, " THEN%s ", v.gaps[i-1])
+			}
+			b.WriteString(f.val(val))
+		}
+		return b.String()
+	default:
+		return n.Condition()
+	}
+}
+
+// chain returns the operands of the node joined by the operator, OR lists that are too long are split into one
+// operand per line
+func (f formatter) chain(n node, operands []node, operator string, precedence int, prec int, indent string) string {
+	if operator != "OR" || !f.tooLong(n, prec, indent) {
+		parts := make([]string, len(operands))
+		for i, operand := range operands {
+			parts[i] = f.format(operand, precedence+1, indent)
+		}
+		return parenthesize(strings.Join(parts, " "+operator+" "), precedence < prec)
+	}
+	if prec == precedenceRoot {
+		parts := make([]string, len(operands))
+		for i, operand := range operands {
+			parts[i] = f.format(operand, precedence+1, indent)
+		}
+		return strings.Join(parts, "\n"+indent+operator+" ")
+	}
+	// split lists are always in parentheses unless they are the whole condition
+	inner := indent + formatIndent
+	parts := make([]string, len(operands))
+	for i, operand := range operands {
+		parts[i] = f.format(operand, precedence+1, inner)
+	}
+	return "(\n" + inner + strings.Join(parts, "\n"+inner+operator+" ") + "\n" + indent + ")"
+}
+
+// list returns the elements separated by commas between the opening and the closing text, one element per line if
+// they do not fit into a line
+func (f formatter) list(opening string, elems []string, closing string, indent string) string {
+	s := opening + strings.Join(elems, ", ") + closing
+	if f.width < 0 || (utf8.RuneCountInString(indent+s) <= f.width && !strings.Contains(s, "\n")) {
+		return s
+	}
+	inner := indent + formatIndent
+	return opening + "\n" + inner + strings.Join(elems, ",\n"+inner) + "\n" + indent + closing
+}
+
+// tooLong returns true if the node does not fit into the line
+func (f formatter) tooLong(n node, prec int, indent string) bool {
+	if f.width < 0 {
+		return false
+	}
+	return utf8.RuneCountInString(indent+formatter{width: -1, placeholder: f.placeholder}.format(n, prec, "")) > f.width
+}
+
+func parenthesize(s string, required bool) string {
+	if required {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// val returns the condition of the string, or the reference that has been replaced by it
+func (f formatter) val(n nodeVAL) string {
+	if strings.HasPrefix(n.nodeValue, f.placeholder) {
+		return strings.TrimPrefix(n.nodeValue, f.placeholder)
+	}
+	return n.Condition()
+}
+
+func flattenXor(n nodeXOR) []node {
+	var nodes []node
+	for _, subNode := range n.Children() {
+		if xor, ok := subNode.(nodeXOR); ok {
+			nodes = append(nodes, flattenXor(xor)...)
+		} else {
+			nodes = append(nodes, subNode)
+		}
+	}
+	return nodes
+}
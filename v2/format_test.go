@@ -0,0 +1,111 @@
+package evalostic
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	for _, tc := range []struct {
+		condition string
+		formatted string
+	}{
+		{`"foo" and ("bar" or ("baz"))`, `"foo" AND ("bar" OR "baz")`},
+		{`(("foo"))`, `"foo"`},
+		{`not (not "a") and not ("b" and "c")`, `NOT (NOT "a") AND NOT ("b" AND "c")`},
+		{`("a" -> "b") -> ("c" implies "d")`, `("a" IMPLIES "b") IMPLIES "c" IMPLIES "d"`},
+		{`("a" xor "b") xor "c" or ("d" or "e")`, `"a" XOR "b" XOR "c" OR "d" OR "e"`},
+		{`("a" or "b") xor "c" and "d"`, `("a" OR "b") XOR "c" AND "d"`},
+		{`^"a"$ and "\x62"wi and /a\/b/i and w"*.exe"`, `="a" AND "b"iw AND /a\/b/i AND w"*.exe"`},
+		{`#"x"o>=3 and status   between 1 and 5.50 and user:"root"`, `#"x"o >= 3 AND status BETWEEN 1 AND 5.5 AND user:"root"`},
+		{`"a" near/3w "b" and "a" then "b" then/5 "c"i`, `"a" NEAR/3W "b" AND "a" THEN "b" THEN/5 "c"i`},
+		{`1 of ("a", ("b" or "c")) and all of ["x", "y"] and 2 OF ("x", "y", "z")`, `ANY OF ("a", "b" OR "c") AND ALL OF ("x", "y") AND 2 OF ("x", "y", "z")`},
+		{`2 of @list and (any of @list) and not $a near/3 "b"`, `2 OF @list AND ANY OF @list AND NOT $a NEAR/3 "b"`},
+		{`$shell = ("bash" or "sh")`, `$shell = "bash" OR "sh"`},
+		{`@shells = ["bash",  "sh"]`, `@shells = ["bash", "sh"]`},
+		{
+			`"aaaaaaaaaaaaaaaaaaaa" or "bbbbbbbbbbbbbbbbbbbbbbbb" or "cccccccccccccccccccccccc" or "x" and ("dddddddddddddddddddddd" or "eeeeeeeeeeeeeeeeeeeeeeeeeeeeeee" or "ffffffffffffffffffffffffff")`,
+			"\"aaaaaaaaaaaaaaaaaaaa\"\n" +
+				"OR \"bbbbbbbbbbbbbbbbbbbbbbbb\"\n" +
+				"OR \"cccccccccccccccccccccccc\"\n" +
+				"OR \"x\" AND (\n" +
+				"    \"dddddddddddddddddddddd\"\n" +
+				"    OR \"eeeeeeeeeeeeeeeeeeeeeeeeeeeeeee\"\n" +
+				"    OR \"ffffffffffffffffffffffffff\"\n" +
+				")",
+		},
+		{
+			`2 OF ("aaaaaaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbbbbbbbbbb", "cccccccccccccccccccccccc", "dddddddddddddddd")`,
+			"2 OF (\n" +
+				"    \"aaaaaaaaaaaaaaaaaaaa\",\n" +
+				"    \"bbbbbbbbbbbbbbbbbbbbbbbb\",\n" +
+				"    \"cccccccccccccccccccccccc\",\n" +
+				"    \"dddddddddddddddd\"\n" +
+				")",
+		},
+		{``, ``},
+	} {
+		formatted, err := Format(tc.condition)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.condition, err)
+		}
+		if formatted != tc.formatted {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tc.condition, tc.formatted, formatted)
+		}
+		if again, err := Format(formatted); err != nil || again != formatted {
+			t.Errorf("%s: formatting is not stable: %q, %v", tc.condition, again, err)
+		}
+	}
+	for _, invalid := range []string{`"a" and`, `2 of @`, `0 OF @list`, `@l = "a"`, `"\x0"`} {
+		_, err := Format(invalid)
+		assertTrue(t, err != nil)
+	}
+	for _, tc := range []struct {
+		condition string
+		column    int
+		token     string
+	}{
+		{`"foo" and "bar" // comment`, 17, "//"},
+		{`/* comment */ "foo"`, 1, "/*"},
+		{`$a /* comment */ = "foo"`, 4, "/*"},
+		{`user:"root" /**/`, 13, "/*"},
+		{`"a // b" and "c"`, 0, ""},
+	} {
+		_, err := Format(tc.condition)
+		var parseErr *ParseError
+		if tc.column == 0 {
+			assertTrue(t, err == nil)
+		} else if !errors.As(err, &parseErr) || parseErr.Message != "comment would be removed" ||
+			parseErr.Column != tc.column || parseErr.Token != tc.token {
+			t.Errorf("%s: expected comment at column %d, got: %v", tc.condition, tc.column, err)
+		}
+	}
+}
+
+func TestFormat_randomConditions(t *testing.T) {
+	rand.Seed(0)
+	for i := 0; i < 1000; i++ {
+		condition := randomCondition(5)
+		formatted, err := Format(condition)
+		if err != nil {
+			t.Fatalf("%s: %s", condition, err)
+		}
+		expr1, err1 := ParseCondition(condition)
+		expr2, err2 := ParseCondition(formatted)
+		if err1 != nil || err2 != nil || expr1.String() != expr2.String() {
+			t.Fatalf("%s: formatted condition %s is not equivalent", condition, formatted)
+		}
+	}
+}
+
+func ExampleFormat() {
+	formatted, err := Format(`("foo" or "bar") and not (/ba+z/i) -> ("qux")`)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(formatted)
+	// Output:
+	// ("foo" OR "bar") AND NOT /ba+z/i IMPLIES "qux"
+}
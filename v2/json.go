@@ -0,0 +1,323 @@
+package evalostic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// jsonExpr is the JSON representation of all expressions, e.g.
+//
+//	{"type": "and", "children": [{"type": "string", "value": "foo"}, {"type": "regex", "value": "ba+r", "caseInsensitive": true}]}
+//
+// The type is one of and, or, xor, implies, not, of, string, regex, wildcard, near, then, count and number. Strings,
+// regexes, wildcards and numbers have a value, all other expressions have children. The gaps of near and then are
+// the gaps between their children.
+type jsonExpr struct {
+	Type            string            `json:"type"`
+	Value           json.RawMessage   `json:"value,omitempty"` // a string or, for numbers, a number
+	Children        []json.RawMessage `json:"children,omitempty"`
+	Field           string            `json:"field,omitempty"`
+	CaseInsensitive bool              `json:"caseInsensitive,omitempty"`
+	Anchor          string            `json:"anchor,omitempty"` // one of start, end and equal
+	Word            bool              `json:"word,omitempty"`
+	Min             int               `json:"min,omitempty"`
+	Gaps            []Gap             `json:"gaps,omitempty"`
+	Comparison      string            `json:"comparison,omitempty"`
+	Count           int               `json:"count,omitempty"`
+	Overlapping     bool              `json:"overlapping,omitempty"`
+	Max             float64           `json:"max,omitempty"`
+	Between         bool              `json:"between,omitempty"`
+}
+
+var anchorJSON = map[Anchor]string{
+	AnchorStart: "start",
+	AnchorEnd:   "end",
+	AnchorEqual: "equal",
+}
+
+var kindJSON = map[StrKind]string{
+	KindString:   "string",
+	KindRegex:    "regex",
+	KindWildcard: "wildcard",
+}
+
+// MarshalJSON returns the JSON representation of a gap, e.g. {"distance": 5, "words": true}
+func (g Gap) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Distance int  `json:"distance"`
+		Words    bool `json:"words,omitempty"`
+	}{g.Distance, g.Words})
+}
+
+func (e AndExpr) MarshalJSON() ([]byte, error) {
+	return marshalExpr("and", e.Exprs, nil)
+}
+
+func (e OrExpr) MarshalJSON() ([]byte, error) {
+	return marshalExpr("or", e.Exprs, nil)
+}
+
+func (e XorExpr) MarshalJSON() ([]byte, error) {
+	return marshalExpr("xor", []Expr{e.X, e.Y}, nil)
+}
+
+func (e ImpliesExpr) MarshalJSON() ([]byte, error) {
+	return marshalExpr("implies", []Expr{e.X, e.Y}, nil)
+}
+
+func (e NotExpr) MarshalJSON() ([]byte, error) {
+	return marshalExpr("not", []Expr{e.X}, nil)
+}
+
+func (e OfExpr) MarshalJSON() ([]byte, error) {
+	return marshalExpr("of", e.Exprs, &jsonExpr{Min: e.Min})
+}
+
+func (e StrExpr) MarshalJSON() ([]byte, error) {
+	value, err := json.Marshal(e.Value)
+	if err != nil {
+		return nil, err
+	}
+	kind, ok := kindJSON[e.Kind]
+	if !ok {
+		return nil, fmt.Errorf("invalid kind %d", e.Kind)
+	}
+	return json.Marshal(jsonExpr{
+		Type:            kind,
+		Value:           value,
+		Field:           e.Field,
+		CaseInsensitive: e.CaseInsensitive,
+		Anchor:          anchorJSON[e.Anchor],
+		Word:            e.Word,
+	})
+}
+
+func (e NearExpr) MarshalJSON() ([]byte, error) {
+	return marshalExpr("near", []Expr{e.X, e.Y}, &jsonExpr{Gaps: []Gap{e.Gap}})
+}
+
+func (e ThenExpr) MarshalJSON() ([]byte, error) {
+	strs := make([]Expr, len(e.Strs))
+	for i, str := range e.Strs {
+		strs[i] = str
+	}
+	return marshalExpr("then", strs, &jsonExpr{Gaps: e.Gaps})
+}
+
+func (e CountExpr) MarshalJSON() ([]byte, error) {
+	return marshalExpr("count", []Expr{e.Str}, &jsonExpr{Comparison: e.Comparison, Count: e.Count, Overlapping: e.Overlapping})
+}
+
+func (e NumExpr) MarshalJSON() ([]byte, error) {
+	value, err := json.Marshal(e.Value)
+	if err != nil {
+		return nil, err
+	}
+	res := jsonExpr{Type: "number", Value: value, Field: e.Field, Comparison: e.Comparison}
+	if e.Between {
+		res.Comparison, res.Max, res.Between = "", e.Max, true
+	}
+	return json.Marshal(res)
+}
+
+// marshalExpr returns the JSON representation of an expression with children, the attributes contain all other
+// properties of the expression
+func marshalExpr(exprType string, children []Expr, attributes *jsonExpr) ([]byte, error) {
+	var res jsonExpr
+	if attributes != nil {
+		res = *attributes
+	}
+	res.Type = exprType
+	res.Children = make([]json.RawMessage, len(children))
+	for i, child := range children {
+		if child == nil {
+			return nil, errors.New("missing expression")
+		}
+		b, err := json.Marshal(child)
+		if err != nil {
+			return nil, err
+		}
+		res.Children[i] = b
+	}
+	return json.Marshal(res)
+}
+
+// UnmarshalExpr parses the JSON representation of an expression, which is returned by json.Marshal. The expression is
+// checked when it is compiled by NewFromExprs.
+func UnmarshalExpr(data []byte) (Expr, error) {
+	var v jsonExpr
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	children := make([]Expr, len(v.Children))
+	for i, child := range v.Children {
+		expr, err := UnmarshalExpr(child)
+		if err != nil {
+			return nil, err
+		}
+		children[i] = expr
+	}
+	// exactly returns an error if the expression does not have n children
+	exactly := func(n int) error {
+		if len(children) != n {
+			return fmt.Errorf("%s requires %d children, got: %d", v.Type, n, len(children))
+		}
+		return nil
+	}
+	// strs returns the children, which have to be strings, regexes or wildcards
+	strs := func() ([]StrExpr, error) {
+		res := make([]StrExpr, len(children))
+		for i, child := range children {
+			str, ok := child.(StrExpr)
+			if !ok {
+				return nil, fmt.Errorf("%s requires strings, got: %s", v.Type, child)
+			}
+			res[i] = str
+		}
+		return res, nil
+	}
+	switch v.Type {
+	case "and":
+		return AndExpr{Exprs: children}, nil
+	case "or":
+		return OrExpr{Exprs: children}, nil
+	case "xor":
+		if err := exactly(2); err != nil {
+			return nil, err
+		}
+		return XorExpr{X: children[0], Y: children[1]}, nil
+	case "implies":
+		if err := exactly(2); err != nil {
+			return nil, err
+		}
+		return ImpliesExpr{X: children[0], Y: children[1]}, nil
+	case "not":
+		if err := exactly(1); err != nil {
+			return nil, err
+		}
+		return NotExpr{X: children[0]}, nil
+	case "of":
+		return OfExpr{Min: v.Min, Exprs: children}, nil
+	case "string", "regex", "wildcard":
+		res := StrExpr{Field: v.Field, CaseInsensitive: v.CaseInsensitive, Word: v.Word}
+		for kind, s := range kindJSON {
+			if s == v.Type {
+				res.Kind = kind
+			}
+		}
+		if err := json.Unmarshal(v.Value, &res.Value); err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %s", v.Type, err)
+		}
+		if v.Anchor != "" {
+			res.Anchor = -1
+			for anchor, s := range anchorJSON {
+				if s == v.Anchor {
+					res.Anchor = anchor
+				}
+			}
+			if res.Anchor < 0 {
+				return nil, fmt.Errorf("invalid anchor %q", v.Anchor)
+			}
+		}
+		return res, nil
+	case "near":
+		if err := exactly(2); err != nil {
+			return nil, err
+		}
+		s, err := strs()
+		if err != nil {
+			return nil, err
+		}
+		if len(v.Gaps) != 1 {
+			return nil, fmt.Errorf("near requires 1 gap, got: %d", len(v.Gaps))
+		}
+		return NearExpr{X: s[0], Y: s[1], Gap: v.Gaps[0]}, nil
+	case "then":
+		s, err := strs()
+		if err != nil {
+			return nil, err
+		}
+		return ThenExpr{Strs: s, Gaps: v.Gaps}, nil
+	case "count":
+		if err := exactly(1); err != nil {
+			return nil, err
+		}
+		s, err := strs()
+		if err != nil {
+			return nil, err
+		}
+		return CountExpr{Str: s[0], Comparison: v.Comparison, Count: v.Count, Overlapping: v.Overlapping}, nil
+	case "number":
+		res := NumExpr{Field: v.Field, Comparison: v.Comparison, Max: v.Max, Between: v.Between}
+		if err := json.Unmarshal(v.Value, &res.Value); err != nil {
+			return nil, fmt.Errorf("invalid value of number: %s", err)
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("invalid type of expression %q", v.Type)
+	}
+}
+
+// UnmarshalJSON parses a gap, the distance defaults to -1 if it is missing
+func (g *Gap) UnmarshalJSON(data []byte) error {
+	v := struct {
+		Distance *int `json:"distance"`
+		Words    bool `json:"words"`
+	}{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*g = Gap{Distance: -1, Words: v.Words}
+	if v.Distance != nil {
+		g.Distance = *v.Distance
+	}
+	return nil
+}
+
+func (e *AndExpr) UnmarshalJSON(data []byte) error     { return unmarshalExprInto(data, e) }
+func (e *OrExpr) UnmarshalJSON(data []byte) error      { return unmarshalExprInto(data, e) }
+func (e *XorExpr) UnmarshalJSON(data []byte) error     { return unmarshalExprInto(data, e) }
+func (e *ImpliesExpr) UnmarshalJSON(data []byte) error { return unmarshalExprInto(data, e) }
+func (e *NotExpr) UnmarshalJSON(data []byte) error     { return unmarshalExprInto(data, e) }
+func (e *OfExpr) UnmarshalJSON(data []byte) error      { return unmarshalExprInto(data, e) }
+func (e *StrExpr) UnmarshalJSON(data []byte) error     { return unmarshalExprInto(data, e) }
+func (e *NearExpr) UnmarshalJSON(data []byte) error    { return unmarshalExprInto(data, e) }
+func (e *ThenExpr) UnmarshalJSON(data []byte) error    { return unmarshalExprInto(data, e) }
+func (e *CountExpr) UnmarshalJSON(data []byte) error   { return unmarshalExprInto(data, e) }
+func (e *NumExpr) UnmarshalJSON(data []byte) error     { return unmarshalExprInto(data, e) }
+
+// unmarshalExprInto parses the JSON representation of an expression into the target, which has to be a pointer to
+// an expression of the same type
+func unmarshalExprInto(data []byte, target interface{}) error {
+	expr, err := UnmarshalExpr(data)
+	if err != nil {
+		return err
+	}
+	v := reflect.ValueOf(target).Elem()
+	if reflect.TypeOf(expr) != v.Type() {
+		return fmt.Errorf("cannot unmarshal expression of type %T into %s", expr, v.Type())
+	}
+	v.Set(reflect.ValueOf(expr))
+	return nil
+}
+
+// NewFromJSON builds a new Evalostic matcher like NewFromExprs from a JSON array of expressions.
+func NewFromJSON(data []byte, options Options) (*Evalostic, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("could not parse expressions: %w", err)
+	}
+	exprs := make([]Expr, len(raw))
+	invalid := make(map[int]error)
+	for i, r := range raw {
+		expr, err := UnmarshalExpr(r)
+		if err != nil {
+			invalid[i] = err
+			continue
+		}
+		exprs[i] = expr
+	}
+	return newFromExprs(exprs, invalid, options)
+}
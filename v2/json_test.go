@@ -0,0 +1,94 @@
+package evalostic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	for _, condition := range []string{
+		`"foo" AND NOT ("bar" OR "baz")`,
+		`user:^"root"iw XOR host:/^srv\d+/i -> NOT w"*.exe"i`,
+		`="a" AND "b"$ AND 2 OF ("a", "b" OR "c", NOT "d")`,
+		`#"foo"o >= 3 AND "a" NEAR/3W "b"i AND "a" THEN/5 "b" THEN "c"`,
+		`status >= 500 AND duration BETWEEN 0 AND 5 AND size != 0.5`,
+	} {
+		root, err := parseCondition(condition)
+		assertTrue(t, err == nil)
+		b, err := json.Marshal(exprOf(root))
+		assertTrue(t, err == nil)
+		expr, err := UnmarshalExpr(b)
+		if err != nil {
+			t.Fatalf("%s: %s", b, err)
+		}
+		assertTrue(t, reflect.DeepEqual(expr, exprOf(root)))
+		n, err := toNode(expr)
+		assertTrue(t, err == nil)
+		assertTrue(t, n.Condition() == root.Condition())
+	}
+	var and AndExpr
+	assertTrue(t, json.Unmarshal([]byte(`{"type": "and", "children": [{"type": "string", "value": "a"}]}`), &and) == nil)
+	assertTrue(t, reflect.DeepEqual(and, And(Str("a"))))
+	assertTrue(t, json.Unmarshal([]byte(`{"type": "or", "children": [{"type": "string", "value": "a"}]}`), &and) != nil)
+	for _, invalid := range []string{
+		`[]`,
+		`{"type": "foo"}`,
+		`{"type": "not", "children": []}`,
+		`{"type": "string", "value": 1}`,
+		`{"type": "string", "value": "a", "anchor": "middle"}`,
+		`{"type": "near", "children": [{"type": "string", "value": "a"}, {"type": "not", "children": [{"type": "string", "value": "b"}]}], "gaps": [{"distance": 1}]}`,
+		`{"type": "count", "children": [{"type": "string", "value": "a"}, {"type": "string", "value": "b"}]}`,
+		`{"type": "number", "field": "status", "value": "500"}`,
+	} {
+		_, err := UnmarshalExpr([]byte(invalid))
+		assertTrue(t, err != nil)
+	}
+}
+
+func TestNewFromJSON(t *testing.T) {
+	e, err := NewFromJSON([]byte(`[
+		{"type": "and", "children": [{"type": "string", "value": "foo"}, {"type": "not", "children": [{"type": "regex", "value": "ba+r", "caseInsensitive": true}]}]},
+		{"type": "then", "children": [{"type": "string", "value": "a"}, {"type": "string", "value": "b"}], "gaps": [{}]},
+		{"type": "number", "field": "status", "value": 500, "max": 599, "between": true}
+	]`), Options{})
+	assertTrue(t, err == nil)
+	assertTrue(t, sameIntegers(e.Match("foo"), []int{0}))
+	assertTrue(t, sameIntegers(e.Match("foo BAAR"), []int{}))
+	assertTrue(t, sameIntegers(e.Match("b a b"), []int{1}))
+	assertTrue(t, sameIntegers(e.MatchFields(map[string]string{"status": "503"}), []int{2}))
+	for _, invalid := range []string{
+		`{}`,
+		`[{"type": "string", "value": "a"}, {"type": "of", "min": 2, "children": [{"type": "string", "value": "a"}]}]`,
+		`[{"type": "string", "value": "a", "field": "not a field"}]`,
+	} {
+		_, err := NewFromJSON([]byte(invalid), Options{})
+		assertTrue(t, err != nil)
+	}
+	e, err = NewFromJSON([]byte(`[{"type": "string", "value": "a"}, {"type": "unknown"}]`), Options{SkipInvalid: true})
+	var multiErr *MultiError
+	assertTrue(t, errors.As(err, &multiErr) && sameIntegers(multiErr.Indices(), []int{1}))
+	assertTrue(t, sameIntegers(e.Match("a"), []int{0}))
+}
+
+func ExampleUnmarshalExpr() {
+	expr, err := ParseCondition(`"foo" AND NOT /ba+r/i`)
+	if err != nil {
+		panic(err)
+	}
+	b, err := json.Marshal(expr)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(b))
+	expr, err = UnmarshalExpr(b)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(expr)
+	// Output:
+	// {"type":"and","children":[{"type":"string","value":"foo"},{"type":"not","children":[{"type":"regex","value":"ba+r","caseInsensitive":true}]}]}
+	// ("foo" AND NOT /ba+r/i)
+}
@@ -5,6 +5,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type tokenType int8
@@ -17,18 +19,63 @@ const (
 	tokenTypeVAL
 	tokenTypeLPAR
 	tokenTypeRPAR
+	tokenTypeREGEX
+	tokenTypeWILDCARD
+	tokenTypeOF
+	tokenTypeNUM
+	tokenTypeCOMMA
+	tokenTypeCOUNT
+	tokenTypeCMP
+	tokenTypeNEAR
+	tokenTypeTHEN
+	tokenTypeXOR
+	tokenTypeIMPLIES
+	tokenTypeANY
+	tokenTypeALL
+	tokenTypeLBRACK
+	tokenTypeRBRACK
+	tokenTypeLIST
+	tokenTypeASSIGN
+	tokenTypeREF
+	tokenTypeFIELD
+	tokenTypeIDENT
+	tokenTypeBETWEEN
 )
 
 var tokenTypeString = map[tokenType]string{
-	tokenTypeNONE: "NONE",
-	tokenTypeAND:  "nodeAND",
-	tokenTypeOR:   "nodeOR",
-	tokenTypeNOT:  "nodeNOT",
-	tokenTypeVAL:  "nodeVAL",
-	tokenTypeLPAR: "LPAR",
-	tokenTypeRPAR: "RPAR",
+	tokenTypeNONE:     "NONE",
+	tokenTypeAND:      "nodeAND",
+	tokenTypeOR:       "nodeOR",
+	tokenTypeNOT:      "nodeNOT",
+	tokenTypeVAL:      "nodeVAL",
+	tokenTypeLPAR:     "LPAR",
+	tokenTypeRPAR:     "RPAR",
+	tokenTypeREGEX:    "nodeREGEX",
+	tokenTypeWILDCARD: "nodeWILDCARD",
+	tokenTypeOF:       "nodeOF",
+	tokenTypeNUM:      "NUM",
+	tokenTypeCOMMA:    "COMMA",
+	tokenTypeCOUNT:    "nodeCOUNT",
+	tokenTypeCMP:      "CMP",
+	tokenTypeNEAR:     "nodeNEAR",
+	tokenTypeTHEN:     "nodeTHEN",
+	tokenTypeXOR:      "nodeXOR",
+	tokenTypeIMPLIES:  "nodeIMPLIES",
+	tokenTypeANY:      "ANY",
+	tokenTypeALL:      "ALL",
+	tokenTypeLBRACK:   "LBRACK",
+	tokenTypeRBRACK:   "RBRACK",
+	tokenTypeLIST:     "LIST",
+	tokenTypeASSIGN:   "ASSIGN",
+	tokenTypeREF:      "REF",
+	tokenTypeFIELD:    "FIELD",
+	tokenTypeIDENT:    "IDENT",
+	tokenTypeBETWEEN:  "BETWEEN",
 }
 
+// numberSyntax is the syntax of numbers in conditions and of the numeric values of fields
+const numberSyntax = `-?[0-9]+(?:\.[0-9]+)?`
+
 type tokenDefinition struct {
 	tokenType  tokenType
 	definition *regexp.Regexp
@@ -36,57 +83,185 @@ type tokenDefinition struct {
 
 var tokenDefs = []tokenDefinition{
 	{tokenTypeNONE, regexp.MustCompile(`^[\s\r\n]+`)},
-	{tokenTypeAND, regexp.MustCompile(`^(?i)and`)},
-	{tokenTypeOR, regexp.MustCompile(`^(?i)or`)},
-	{tokenTypeNOT, regexp.MustCompile(`^(?i)not`)},
-	//{tokenTypeVAL, regexp.MustCompile(`^"[^"]*"`)},
-	{tokenTypeVAL, regexp.MustCompile(`^"(?:[^"\\]|\\.)*"(i?)`)}, // deprecated: old implementation supported case sensitive and insensitive strings, do not remove the (i?) suffix
+	{tokenTypeNONE, regexp.MustCompile(`^//[^\n]*`)},                    // line comment
+	{tokenTypeNONE, regexp.MustCompile(`^/\*(?s:.*?)\*/`)},              // block comment
+	{tokenTypeFIELD, regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_.]*):`)}, // the field of the following string
+	{tokenTypeAND, regexp.MustCompile(`^(?i)and\b`)},
+	{tokenTypeOR, regexp.MustCompile(`^(?i)or\b`)},
+	{tokenTypeNOT, regexp.MustCompile(`^(?i)not\b`)},
+	{tokenTypeOF, regexp.MustCompile(`^(?i)of\b`)},
+	{tokenTypeXOR, regexp.MustCompile(`^(?i)xor\b`)},
+	{tokenTypeANY, regexp.MustCompile(`^(?i)any\b`)},
+	{tokenTypeALL, regexp.MustCompile(`^(?i)all\b`)},
+	{tokenTypeBETWEEN, regexp.MustCompile(`^(?i)between\b`)},
+	{tokenTypeIMPLIES, regexp.MustCompile(`^(?:(?i)implies\b|->)`)},
+	{tokenTypeNEAR, regexp.MustCompile(`^(?i)near/([0-9]+)(w?)`)},        // the (w?) suffix measures the distance in words
+	{tokenTypeTHEN, regexp.MustCompile(`^(?i)then(?:/([0-9]+)(w?))?\b`)}, // the optional maximum gap between both strings
+	// the optional ^, = prefixes and $ suffix of strings are anchors, the suffix i marks case insensitive strings,
+	// the suffix w marks strings that have to be whole words and the suffix o marks overlapping counts
+	{tokenTypeVAL, regexp.MustCompile(`^([\^=]?)("(?:[^"\\]|\\.)*")([iwo]*)(\$?)`)},
+	{tokenTypeWILDCARD, regexp.MustCompile(`^w("(?:[^"\\]|\\.)*")(i?)`)}, // the (i?) suffix marks case insensitive wildcards
+	{tokenTypeREGEX, regexp.MustCompile(`^/((?:[^/\\\n]|\\.)+)/(i?)`)},   // the (i?) suffix marks case insensitive regexes
 	{tokenTypeLPAR, regexp.MustCompile(`^\(`)},
 	{tokenTypeRPAR, regexp.MustCompile(`^\)`)},
+	{tokenTypeNUM, regexp.MustCompile(`^` + numberSyntax)},
+	{tokenTypeCOMMA, regexp.MustCompile(`^,`)},
+	{tokenTypeCOUNT, regexp.MustCompile(`^#`)},
+	{tokenTypeCMP, regexp.MustCompile(`^(?:>=|<=|==|!=|>|<)`)},
+	{tokenTypeLBRACK, regexp.MustCompile(`^\[`)},
+	{tokenTypeRBRACK, regexp.MustCompile(`^\]`)},
+	{tokenTypeLIST, regexp.MustCompile(`^@([A-Za-z_][A-Za-z0-9_]*)`)}, // reference or definition of a named list
+	{tokenTypeREF, regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)`)}, // reference or definition of a named condition
+	{tokenTypeASSIGN, regexp.MustCompile(`^=`)},
+	{tokenTypeIDENT, regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*`)}, // the field of a numeric comparison
 }
 
+// definitionPrefix matches the name and the assignment of a definition of a named list or a named condition, both may
+// be preceded by whitespace and comments
+var definitionPrefix = regexp.MustCompile(
+	`^(?:\s|//[^\n]*|/\*(?s:.*?)\*/)*([$@])([A-Za-z_][A-Za-z0-9_]*)(?:\s|//[^\n]*|/\*(?s:.*?)\*/)*=`,
+)
+
 type token struct {
 	tokenType tokenType
 	matched   string
-	pos       int
+	flags     string // optional modifiers of a value, e.g. "i" for case insensitive strings
+	field     string // optional field of a value, e.g. "user" for user:"root"
+	text      string // the token as written in the condition
+	pos       position
+	node      node // the parsed named condition of a reference, see parseConditions
 }
 
 func (t token) String() string {
-	return fmt.Sprintf("%s ( %s ) at pos %d", tokenTypeString[t.tokenType], t.matched, t.pos)
+	if t.field != "" {
+		return fmt.Sprintf("%s ( %s:%s ) at pos %s", tokenTypeString[t.tokenType], t.field, t.matched, t.pos)
+	}
+	return fmt.Sprintf("%s ( %s ) at pos %s", tokenTypeString[t.tokenType], t.matched, t.pos)
+}
+
+// position of a token in a condition, lines and columns start at 1 and columns are counted in characters
+type position struct {
+	offset int // byte offset in the condition
+	line   int
+	column int
+}
+
+func (p position) String() string {
+	return fmt.Sprintf("%d:%d", p.line, p.column)
+}
+
+// advance returns the position after the text
+func (p position) advance(text string) position {
+	for _, r := range text {
+		if r == '\n' {
+			p.line, p.column = p.line+1, 1
+		} else {
+			p.column++
+		}
+	}
+	p.offset += len(text)
+	return p
 }
 
 func tokenize(condition string) (tokens []token, err error) {
-	var pos = 1
+	var (
+		pos    = position{line: 1, column: 1}
+		source = condition
+	)
+	// the prefix of a definition is recognized first, so that $x ="a" is not mistaken for a reference followed by an
+	// anchored string
+	if match := definitionPrefix.FindStringSubmatchIndex(condition); match != nil {
+		tokenType := tokenTypeREF
+		if condition[match[2]] == '@' {
+			tokenType = tokenTypeLIST
+		}
+		tokens = append(tokens,
+			token{
+				tokenType: tokenType,
+				matched:   condition[match[4]:match[5]],
+				text:      condition[match[2]:match[5]],
+				pos:       pos.advance(condition[:match[2]]),
+			},
+			token{tokenType: tokenTypeASSIGN, matched: "=", text: "=", pos: pos.advance(condition[:match[1]-1])},
+		)
+		pos = pos.advance(condition[:match[1]])
+		condition = condition[match[1]:]
+	}
 recognize:
 	for len(condition) > 0 {
+		if strings.HasPrefix(condition, "/*") && !strings.Contains(condition, "*/") {
+			return nil, errorAt(token{text: "/*", pos: pos}, `"*/"`, "unterminated comment")
+		}
 		for _, tokenDef := range tokenDefs {
 			match := tokenDef.definition.FindStringSubmatchIndex(condition)
 			if match != nil {
 				if tokenDef.tokenType != tokenTypeNONE {
 					matched := condition[match[0]:match[1]]
+					t := token{
+						tokenType: tokenDef.tokenType,
+						text:      matched,
+						pos:       pos.advance(condition[:match[0]]),
+					}
+					var flags string
 					if tokenDef.tokenType == tokenTypeVAL {
-						// deprecated: old implementation supported case sensitive and insensitive strings
-						if strings.HasSuffix(matched, "i") {
-							matched = strings.TrimSuffix(matched, "i")
+						quoted := condition[match[4]:match[5]]
+						unquote, err := strconv.Unquote(quoted)
+						if err != nil {
+							return nil, errorAt(t, "", "could not unquote %s: %s", quoted, err)
 						}
-						unquote, err := strconv.Unquote(matched)
+						matched = unquote
+						flags = condition[match[2]:match[3]] + condition[match[6]:match[7]] + condition[match[8]:match[9]]
+					} else if tokenDef.tokenType == tokenTypeWILDCARD {
+						quoted := condition[match[2]:match[3]]
+						unquote, err := strconv.Unquote(quoted)
 						if err != nil {
-							return nil, fmt.Errorf("could not unquote %s: %s", matched, err)
+							return nil, errorAt(t, "", "could not unquote %s: %s", quoted, err)
 						}
 						matched = unquote
+						flags = condition[match[4]:match[5]]
+					} else if tokenDef.tokenType == tokenTypeNEAR || tokenDef.tokenType == tokenTypeTHEN {
+						matched, flags = "", ""
+						if match[2] >= 0 {
+							matched = condition[match[2]:match[3]]
+							flags = strings.ToLower(condition[match[4]:match[5]])
+						}
+					} else if tokenDef.tokenType == tokenTypeLIST || tokenDef.tokenType == tokenTypeREF || tokenDef.tokenType == tokenTypeFIELD {
+						matched = condition[match[2]:match[3]]
+					} else if tokenDef.tokenType == tokenTypeREGEX {
+						matched = unquoteRegex(condition[match[2]:match[3]])
+						flags = condition[match[4]:match[5]]
 					}
-					tokens = append(tokens, token{
-						tokenType: tokenDef.tokenType,
-						matched:   matched,
-						pos:       pos + match[0],
-					})
+					t.matched, t.flags = matched, flags
+					if n := len(tokens); n > 0 && tokens[n-1].tokenType == tokenTypeFIELD {
+						// the field is merged into the following string
+						switch t.tokenType {
+						case tokenTypeVAL, tokenTypeREGEX, tokenTypeWILDCARD:
+							t.field, t.text = tokens[n-1].matched, source[tokens[n-1].pos.offset:t.pos.offset+len(t.text)]
+							t.pos = tokens[n-1].pos
+							tokens = tokens[:n-1]
+						default:
+							return nil, errorAt(t, "a string", "field %s must be followed by a string", tokens[n-1].matched)
+						}
+					}
+					tokens = append(tokens, t)
 				}
-				pos += match[1]
+				pos = pos.advance(condition[:match[1]])
 				condition = condition[match[1]:]
 				goto recognize
 			}
 		}
-		return nil, fmt.Errorf("unexpected token in condition at position %s", condition)
+		// the unknown token ends at the next whitespace, whitespace that is not matched by \s is an unknown token itself
+		end := strings.IndexFunc(condition, unicode.IsSpace)
+		if end == 0 {
+			_, end = utf8.DecodeRuneInString(condition)
+		} else if end < 0 {
+			end = len(condition)
+		}
+		text := condition[:end]
+		return nil, errorAt(token{text: text, pos: pos}, "", "unknown token %s", text)
+	}
+	if n := len(tokens); n > 0 && tokens[n-1].tokenType == tokenTypeFIELD {
+		return nil, errorAt(token{pos: pos}, "a string", "field %s must be followed by a string", tokens[n-1].matched)
 	}
 	return
 }
@@ -99,3 +274,21 @@ func findToken(tokens []token, tokenType tokenType) int {
 	}
 	return -1
 }
+
+// findListSeparator returns the position of the first comma that is not inside of parentheses or brackets
+func findListSeparator(tokens []token) int {
+	var lpar int
+	for i, t := range tokens {
+		switch t.tokenType {
+		case tokenTypeLPAR, tokenTypeLBRACK:
+			lpar++
+		case tokenTypeRPAR, tokenTypeRBRACK:
+			lpar--
+		case tokenTypeCOMMA:
+			if lpar == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -18,30 +18,61 @@ func Example_tokenize() {
 	tk(`"foo" AND ("bar" OR "baz")`)
 	tk(`"foo" AND ("bar" OR NOT "baz")`)
 	tk(`"escaped quote: \""`)
+	tk(`"foo"i AND /a\/b\d+/i`)
+	tk(`^"GET "i OR ".exe"$ OR ="admin"`)
+	tk(`user:"root" AND android:/x/ OR NOT event.id:^"4624"`)
+	tk(`"foo" // line comment
+  /* block
+  comment */ AND "bär" /* inline */ OR /x/`)
 	// Output:
 	// ----- "foo" -----
-	// nodeVAL ( foo ) at pos 1
+	// nodeVAL ( foo ) at pos 1:1
 	// ----- "foo" AND "bar" -----
-	// nodeVAL ( foo ) at pos 1
-	// nodeAND ( AND ) at pos 7
-	// nodeVAL ( bar ) at pos 11
+	// nodeVAL ( foo ) at pos 1:1
+	// nodeAND ( AND ) at pos 1:7
+	// nodeVAL ( bar ) at pos 1:11
 	// ----- "foo" AND ("bar" OR "baz") -----
-	// nodeVAL ( foo ) at pos 1
-	// nodeAND ( AND ) at pos 7
-	// LPAR ( ( ) at pos 11
-	// nodeVAL ( bar ) at pos 12
-	// nodeOR ( OR ) at pos 18
-	// nodeVAL ( baz ) at pos 21
-	// RPAR ( ) ) at pos 26
+	// nodeVAL ( foo ) at pos 1:1
+	// nodeAND ( AND ) at pos 1:7
+	// LPAR ( ( ) at pos 1:11
+	// nodeVAL ( bar ) at pos 1:12
+	// nodeOR ( OR ) at pos 1:18
+	// nodeVAL ( baz ) at pos 1:21
+	// RPAR ( ) ) at pos 1:26
 	// ----- "foo" AND ("bar" OR NOT "baz") -----
-	// nodeVAL ( foo ) at pos 1
-	// nodeAND ( AND ) at pos 7
-	// LPAR ( ( ) at pos 11
-	// nodeVAL ( bar ) at pos 12
-	// nodeOR ( OR ) at pos 18
-	// nodeNOT ( NOT ) at pos 21
-	// nodeVAL ( baz ) at pos 25
-	// RPAR ( ) ) at pos 30
+	// nodeVAL ( foo ) at pos 1:1
+	// nodeAND ( AND ) at pos 1:7
+	// LPAR ( ( ) at pos 1:11
+	// nodeVAL ( bar ) at pos 1:12
+	// nodeOR ( OR ) at pos 1:18
+	// nodeNOT ( NOT ) at pos 1:21
+	// nodeVAL ( baz ) at pos 1:25
+	// RPAR ( ) ) at pos 1:30
 	// ----- "escaped quote: \"" -----
-	// nodeVAL ( escaped quote: " ) at pos 1
+	// nodeVAL ( escaped quote: " ) at pos 1:1
+	// ----- "foo"i AND /a\/b\d+/i -----
+	// nodeVAL ( foo ) at pos 1:1
+	// nodeAND ( AND ) at pos 1:8
+	// nodeREGEX ( a/b\d+ ) at pos 1:12
+	// ----- ^"GET "i OR ".exe"$ OR ="admin" -----
+	// nodeVAL ( GET  ) at pos 1:1
+	// nodeOR ( OR ) at pos 1:10
+	// nodeVAL ( .exe ) at pos 1:13
+	// nodeOR ( OR ) at pos 1:21
+	// nodeVAL ( admin ) at pos 1:24
+	// ----- user:"root" AND android:/x/ OR NOT event.id:^"4624" -----
+	// nodeVAL ( user:root ) at pos 1:1
+	// nodeAND ( AND ) at pos 1:13
+	// nodeREGEX ( android:x ) at pos 1:17
+	// nodeOR ( OR ) at pos 1:29
+	// nodeNOT ( NOT ) at pos 1:32
+	// nodeVAL ( event.id:4624 ) at pos 1:36
+	// ----- "foo" // line comment
+	//   /* block
+	//   comment */ AND "bär" /* inline */ OR /x/ -----
+	// nodeVAL ( foo ) at pos 1:1
+	// nodeAND ( AND ) at pos 3:14
+	// nodeVAL ( bär ) at pos 3:18
+	// nodeOR ( OR ) at pos 3:37
+	// nodeREGEX ( x ) at pos 3:40
 }
@@ -1,9 +1,21 @@
 package evalostic
 
-func extractStrings(n node) ([]string, bool) {
+func extractStrings(n node) ([]literal, bool) {
 	switch v := n.(type) {
-	case nodeVAL:
-		return []string{v.nodeValue}, true
+	case nodeOF:
+		// the nodeOF can only match without any string if enough of its sub nodes are negative
+		var negatives int
+		for _, subNode := range v.nodes {
+			if _, positive := extractStrings(subNode); !positive {
+				negatives++
+			}
+		}
+		return []literal{v.literal()}, v.min > negatives
+	case nodeCOUNT:
+		// a count can only match without any string if zero occurrences satisfy the comparison
+		return []literal{v.literal()}, !v.comparison.compare(0, float64(v.count))
+	case leaf:
+		return []literal{v.literal()}, true
 	case nodeAND:
 		n1str, n1b := extractStrings(v.node1)
 		n2str, n2b := extractStrings(v.node2)
@@ -12,6 +24,16 @@ func extractStrings(n node) ([]string, bool) {
 		n1str, n1b := extractStrings(v.node1)
 		n2str, n2b := extractStrings(v.node2)
 		return append(n1str, n2str...), n1b && n2b
+	case nodeXOR:
+		// positive means that the node does not match if no string was found, so a nodeXOR is positive if both
+		// sub nodes are positive or both are negative
+		n1str, n1b := extractStrings(v.node1)
+		n2str, n2b := extractStrings(v.node2)
+		return append(n1str, n2str...), n1b == n2b
+	case nodeIMPLIES:
+		n1str, n1b := extractStrings(v.node1)
+		n2str, n2b := extractStrings(v.node2)
+		return append(n1str, n2str...), !n1b && n2b
 	case nodeNOT:
 		str, nb := extractStrings(v.node)
 		return str, !nb
@@ -19,3 +41,11 @@ func extractStrings(n node) ([]string, bool) {
 		return nil, true
 	}
 }
+
+// walk calls fn for the node and all of its sub nodes
+func walk(n node, fn func(n node)) {
+	fn(n)
+	for _, subNode := range n.Children() {
+		walk(subNode, fn)
+	}
+}
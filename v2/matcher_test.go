@@ -25,33 +25,33 @@ func Example_extractStrings() {
 	es(`NOT ("foo" AND NOT "bar")`)
 	// Output:
 	// ----- "foo" -----
-	// strings: [foo]
+	// strings: ["foo"]
 	// positive: true
 	// ----- "foo" AND "bar" -----
-	// strings: [foo bar]
+	// strings: ["foo" "bar"]
 	// positive: true
 	// ----- "foo" OR "bar" -----
-	// strings: [foo bar]
+	// strings: ["foo" "bar"]
 	// positive: true
 	// ----- NOT "foo" -----
-	// strings: [foo]
+	// strings: ["foo"]
 	// positive: false
 	// ----- "foo" AND NOT "bar" -----
-	// strings: [foo bar]
+	// strings: ["foo" "bar"]
 	// positive: true
 	// ----- "foo" OR NOT "bar" -----
-	// strings: [foo bar]
+	// strings: ["foo" "bar"]
 	// positive: false
 	// ----- NOT ("foo" OR "bar") -----
-	// strings: [foo bar]
+	// strings: ["foo" "bar"]
 	// positive: false
 	// ----- NOT ("foo" AND "bar") -----
-	// strings: [foo bar]
+	// strings: ["foo" "bar"]
 	// positive: false
 	// ----- NOT ("foo" OR NOT "bar") -----
-	// strings: [foo bar]
+	// strings: ["foo" "bar"]
 	// positive: true
 	// ----- NOT ("foo" AND NOT "bar") -----
-	// strings: [foo bar]
+	// strings: ["foo" "bar"]
 	// positive: false
 }
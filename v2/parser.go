@@ -1,7 +1,6 @@
 package evalostic
 
 import (
-	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -11,37 +10,256 @@ type node interface {
 	String() string
 	Condition() string
 	Value() string
-	Children() (node, node)
+	Children() []node
 	SOP() node
 }
 
+// anchor restricts the position of a string
+type anchor int8
+
+const (
+	anchorNone  anchor = iota
+	anchorStart        // ^"foo": the string has to start with foo
+	anchorEnd          // "foo"$: the string has to end with foo
+	anchorEqual        // ="foo": the string has to be equal to foo
+)
+
+func parseAnchor(flags string) anchor {
+	start := strings.Contains(flags, "^")
+	end := strings.Contains(flags, "$")
+	switch {
+	case strings.Contains(flags, "=") || start && end:
+		return anchorEqual
+	case start:
+		return anchorStart
+	case end:
+		return anchorEnd
+	default:
+		return anchorNone
+	}
+}
+
+// quote returns the string with the notation of its anchor
+func (a anchor) quote(s string) string {
+	switch a {
+	case anchorStart:
+		return "^" + s
+	case anchorEnd:
+		return s + "$"
+	case anchorEqual:
+		return "=" + s
+	default:
+		return s
+	}
+}
+
+// comparison compares a number with a reference number
+type comparison int8
+
+const (
+	comparisonGE comparison = iota
+	comparisonGT
+	comparisonLE
+	comparisonLT
+	comparisonEQ
+	comparisonNE
+)
+
+var comparisonString = map[comparison]string{
+	comparisonGE: ">=",
+	comparisonGT: ">",
+	comparisonLE: "<=",
+	comparisonLT: "<",
+	comparisonEQ: "==",
+	comparisonNE: "!=",
+}
+
+func parseComparison(s string) (comparison, error) {
+	for c, str := range comparisonString {
+		if str == s {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid comparison %s", s)
+}
+
+func (c comparison) String() string {
+	return comparisonString[c]
+}
+
+func (c comparison) compare(a, b float64) bool {
+	switch c {
+	case comparisonGE:
+		return a >= b
+	case comparisonGT:
+		return a > b
+	case comparisonLE:
+		return a <= b
+	case comparisonLT:
+		return a < b
+	case comparisonEQ:
+		return a == b
+	default:
+		return a != b
+	}
+}
+
+// negate returns the comparison that is true if and only if this comparison is false
+func (c comparison) negate() comparison {
+	switch c {
+	case comparisonGE:
+		return comparisonLT
+	case comparisonGT:
+		return comparisonLE
+	case comparisonLE:
+		return comparisonGT
+	case comparisonLT:
+		return comparisonGE
+	case comparisonEQ:
+		return comparisonNE
+	default:
+		return comparisonEQ
+	}
+}
+
+// gap is the maximum distance between two strings
+type gap struct {
+	distance int  // -1 if the distance is not limited
+	words    bool // the distance is measured in words instead of characters
+}
+
+func parseGap(t token) (gap, error) {
+	if t.matched == "" {
+		return gap{distance: -1}, nil
+	}
+	distance, err := strconv.Atoi(t.matched)
+	if err != nil {
+		return gap{}, errorAt(t, "", "invalid distance %s: %s", t.matched, err)
+	}
+	return gap{distance: distance, words: t.flags == "w"}, nil
+}
+
+// String returns the gap in the notation of NEAR and THEN operators, e.g. /5W
+func (g gap) String() string {
+	if g.distance < 0 {
+		return ""
+	}
+	var unit string
+	if g.words {
+		unit = "W"
+	}
+	return fmt.Sprintf("/%d%s", g.distance, unit)
+}
+
+// allows returns true if the distance between two occurrences is not too long
+func (g gap) allows(distance int) bool {
+	return g.distance < 0 || distance <= g.distance
+}
+
 type (
-	oneSubNode  struct{ node node }
-	twoSubNodes struct{ node1, node2 node }
-	valueNode   struct {
-		nodeValue string
+	oneSubNode    struct{ node node }
+	twoSubNodes   struct{ node1, node2 node }
+	multiSubNodes struct{ nodes []node }
+	valueNode     struct {
+		nodeValue       string
+		caseInsensitive bool
+		field           string // empty if the value can be found in any field
 	}
 )
 
-func (oneSubNode) Value() string  { return "" }
-func (twoSubNodes) Value() string { return "" }
-func (n valueNode) Value() string { return n.nodeValue }
+func (oneSubNode) Value() string    { return "" }
+func (twoSubNodes) Value() string   { return "" }
+func (multiSubNodes) Value() string { return "" }
+func (n valueNode) Value() string   { return n.nodeValue }
 
-func (n oneSubNode) Children() (node, node)  { return n.node, nil }
-func (n twoSubNodes) Children() (node, node) { return n.node1, n.node2 }
-func (valueNode) Children() (node, node)     { return nil, nil }
+func (n oneSubNode) Children() []node    { return []node{n.node} }
+func (n twoSubNodes) Children() []node   { return []node{n.node1, n.node2} }
+func (n multiSubNodes) Children() []node { return n.nodes }
+func (valueNode) Children() []node       { return nil }
+
+// leaf is a node without sub nodes that is represented by a single literal
+type leaf interface {
+	node
+	literal() literal
+}
 
 type (
 	nodeAND struct{ twoSubNodes }
 	nodeOR  struct{ twoSubNodes }
-	nodeNOT struct{ oneSubNode }
-	nodeVAL struct{ valueNode }
+	nodeXOR struct{ twoSubNodes }
+	// nodeIMPLIES matches if node1 does not match or both nodes match
+	nodeIMPLIES struct{ twoSubNodes }
+	nodeNOT     struct{ oneSubNode }
+	nodeVAL     struct {
+		valueNode
+		anchor anchor
+		word   bool // the string must not be part of a longer word
+	}
+	nodeREGEX    struct{ valueNode }
+	nodeWILDCARD struct{ valueNode }
+	nodeOF       struct {
+		multiSubNodes
+		min int // minimum number of sub nodes that have to match
+	}
+	nodeNEAR struct {
+		val1, val2 nodeVAL
+		gap        gap // maximum distance between both strings
+	}
+	nodeTHEN struct {
+		vals []nodeVAL
+		gaps []gap // gaps[i] is the maximum gap between vals[i] and vals[i+1]
+	}
+	nodeCOUNT struct {
+		val         nodeVAL
+		comparison  comparison
+		count       int
+		overlapping bool // count overlapping occurrences, e.g. "aa" occurs twice in "aaa"
+	}
+	// nodeNUM compares the numeric value of a field, e.g. status >= 500 or duration BETWEEN 1 AND 5
+	nodeNUM struct {
+		field      string
+		comparison comparison // unused if between is set
+		value      float64    // lower bound if between is set
+		max        float64    // upper bound if between is set
+		between    bool
+	}
 )
 
-func (n nodeAND) String() string { return fmt.Sprintf("nodeAND{%s,%s}", n.node1, n.node2) }
-func (n nodeOR) String() string  { return fmt.Sprintf("nodeOR{%s,%s}", n.node1, n.node2) }
-func (n nodeNOT) String() string { return fmt.Sprintf("nodeNOT{%s}", n.node) }
-func (n nodeVAL) String() string { return fmt.Sprintf("nodeVAL{%q}", n.nodeValue) }
+func (nodeNUM) Value() string    { return "" }
+func (nodeNUM) Children() []node { return nil }
+func (n nodeNUM) String() string { return fmt.Sprintf("nodeNUM{%s}", n.Condition()) }
+
+func (nodeCOUNT) Value() string      { return "" }
+func (n nodeCOUNT) Children() []node { return []node{n.val} }
+func (nodeTHEN) Value() string       { return "" }
+func (nodeNEAR) Value() string       { return "" }
+func (n nodeNEAR) Children() []node  { return []node{n.val1, n.val2} }
+func (n nodeTHEN) Children() []node {
+	children := make([]node, len(n.vals))
+	for i, val := range n.vals {
+		children[i] = val
+	}
+	return children
+}
+
+func (n nodeAND) String() string      { return fmt.Sprintf("nodeAND{%s,%s}", n.node1, n.node2) }
+func (n nodeOR) String() string       { return fmt.Sprintf("nodeOR{%s,%s}", n.node1, n.node2) }
+func (n nodeXOR) String() string      { return fmt.Sprintf("nodeXOR{%s,%s}", n.node1, n.node2) }
+func (n nodeIMPLIES) String() string  { return fmt.Sprintf("nodeIMPLIES{%s,%s}", n.node1, n.node2) }
+func (n nodeNOT) String() string      { return fmt.Sprintf("nodeNOT{%s}", n.node) }
+func (n nodeVAL) String() string      { return fmt.Sprintf("nodeVAL{%s}", n.Condition()) }
+func (n nodeREGEX) String() string    { return fmt.Sprintf("nodeREGEX{%s}", n.Condition()) }
+func (n nodeWILDCARD) String() string { return fmt.Sprintf("nodeWILDCARD{%s}", n.Condition()) }
+func (n nodeCOUNT) String() string    { return fmt.Sprintf("nodeCOUNT{%s}", n.Condition()) }
+func (n nodeNEAR) String() string     { return fmt.Sprintf("nodeNEAR{%s}", n.Condition()) }
+func (n nodeTHEN) String() string     { return fmt.Sprintf("nodeTHEN{%s}", n.Condition()) }
+func (n nodeOF) String() string {
+	subNodes := make([]string, len(n.nodes))
+	for i, subNode := range n.nodes {
+		subNodes[i] = subNode.String()
+	}
+	return fmt.Sprintf("nodeOF{%d,%s}", n.min, strings.Join(subNodes, ","))
+}
 
 func parseCondition(s string) (node, error) {
 	t, err := tokenize(s)
@@ -51,10 +269,225 @@ func parseCondition(s string) (node, error) {
 	return parse(t)
 }
 
+// namedCondition is a condition that is defined with e.g. $shell = "bash" OR "sh" and can be referenced by other
+// conditions
+type namedCondition struct {
+	name string
+	root node
+}
+
+// parseConditions parses all conditions, the result contains nil for empty, invalid and definitions of named lists
+// and named conditions. Lists are defined with e.g. @shells = ["bash", "sh"] and named conditions with e.g.
+// $shell = "bash" OR "sh", both can be referenced before they are defined. References of named conditions are
+// replaced with the named condition in parentheses. The errors contain at most one error per invalid condition in
+// the order in which they were found, invalid named conditions are not part of the result.
+func parseConditions(conditions []string) ([]node, []namedCondition, []*ParseError) {
+	tokens := make([][]token, len(conditions))
+	skip := make([]bool, len(conditions))
+	lists := make(map[string][]token)
+	invalidLists := make(map[string]bool)
+	definitions := make(map[string][]token)
+	var names []string
+	definedIn := make(map[string]int) // index of the condition that defines a named condition
+	// located sets the condition of a ParseError
+	located := func(i int, err error) *ParseError {
+		parseErr, ok := err.(*ParseError)
+		if !ok {
+			parseErr = &ParseError{Message: err.Error()}
+		}
+		parseErr.Condition, parseErr.source = i, conditions[i]
+		return parseErr
+	}
+	var errs []*ParseError
+	invalid := make(map[int]bool)
+	fail := func(err *ParseError) {
+		if !invalid[err.Condition] {
+			invalid[err.Condition] = true
+			errs = append(errs, err)
+		}
+	}
+	for i, condition := range conditions {
+		if condition == "" {
+			skip[i] = true // allow empty conditions but ignore them
+			continue
+		}
+		t, err := tokenize(condition)
+		if err != nil {
+			fail(located(i, err))
+			skip[i] = true
+			continue
+		}
+		if len(t) >= 2 && t[0].tokenType == tokenTypeLIST && t[1].tokenType == tokenTypeASSIGN {
+			skip[i] = true
+			list := t[2:]
+			if _, ok := lists[t[0].matched]; ok {
+				fail(located(i, errorAt(t[0], "", "list @%s is already defined", t[0].matched)))
+				continue
+			}
+			lists[t[0].matched] = list
+			// the list is checked here, so that invalid lists are not reported at their references
+			if _, err := parseList(t); err != nil {
+				fail(located(i, err))
+				invalidLists[t[0].matched] = true
+			}
+			continue
+		}
+		if len(t) >= 2 && t[0].tokenType == tokenTypeREF && t[1].tokenType == tokenTypeASSIGN {
+			skip[i] = true
+			if _, ok := definitions[t[0].matched]; ok {
+				fail(located(i, errorAt(t[0], "", "condition $%s is already defined", t[0].matched)))
+				continue
+			}
+			definitions[t[0].matched] = t[2:]
+			names = append(names, t[0].matched)
+			definedIn[t[0].matched] = i
+			continue
+		}
+		tokens[i] = t
+	}
+	namedRoots := make(map[string]node)
+	namedErrors := make(map[string]*ParseError)
+	// expand replaces the references to named lists of the tokens of condition i with the tokens of the lists and adds
+	// the parsed named conditions to their references, all referenced named conditions have to be parsed before. The
+	// tokens of a list are moved to its reference, so that errors are located in condition i.
+	expand := func(i int, t []token) ([]token, *ParseError) {
+		var expanded []token
+		for _, tk := range t {
+			switch tk.tokenType {
+			case tokenTypeLIST:
+				list, ok := lists[tk.matched]
+				if !ok {
+					return nil, located(i, errorAt(tk, "", "undefined list @%s", tk.matched))
+				}
+				if invalidLists[tk.matched] {
+					return nil, located(i, errorAt(tk, "", "invalid list @%s", tk.matched))
+				}
+				for _, listToken := range list {
+					listToken.text, listToken.pos = tk.text, tk.pos
+					expanded = append(expanded, listToken)
+				}
+			case tokenTypeREF:
+				if _, ok := namedErrors[tk.matched]; ok {
+					return nil, located(i, errorAt(tk, "", "invalid condition $%s", tk.matched))
+				}
+				root, ok := namedRoots[tk.matched]
+				if !ok {
+					return nil, located(i, errorAt(tk, "", "undefined condition $%s", tk.matched))
+				}
+				// the node is shared by all references instead of copying the tokens of the definition, whose size
+				// would grow exponentially with nested references
+				tk.node = root
+				expanded = append(expanded, tk)
+			default:
+				expanded = append(expanded, tk)
+			}
+		}
+		return expanded, nil
+	}
+	// parseNamed parses the named condition after all named conditions that it references, so that every error is
+	// located in the definition that causes it. The stack contains the named conditions that reference this one.
+	var parseNamed func(name string, stack []string) (node, *ParseError)
+	parseNamed = func(name string, stack []string) (node, *ParseError) {
+		if root, ok := namedRoots[name]; ok {
+			return root, nil
+		}
+		if err, ok := namedErrors[name]; ok {
+			return nil, err
+		}
+		i := definedIn[name]
+		root, err := func() (node, *ParseError) {
+			stack := append(stack, name)
+			for _, tk := range definitions[name] {
+				if tk.tokenType != tokenTypeREF {
+					continue
+				}
+				for j, ref := range stack {
+					if ref == tk.matched {
+						cycle := append(append([]string{}, stack[j:]...), ref)
+						return nil, located(i, errorAt(tk, "", "cycle in named conditions: $%s", strings.Join(cycle, " -> $")))
+					}
+				}
+				if _, ok := definitions[tk.matched]; !ok {
+					return nil, located(i, errorAt(tk, "", "undefined condition $%s", tk.matched))
+				}
+				if _, err := parseNamed(tk.matched, stack); err != nil {
+					return nil, located(i, errorAt(tk, "", "invalid condition $%s", tk.matched))
+				}
+			}
+			expanded, err := expand(i, definitions[name])
+			if err != nil {
+				return nil, err
+			}
+			root, parseErr := parse(expanded)
+			if parseErr != nil {
+				return nil, located(i, parseErr)
+			}
+			return root, nil
+		}()
+		if err != nil {
+			namedErrors[name] = err
+			fail(err)
+			return nil, err
+		}
+		namedRoots[name] = root
+		return root, nil
+	}
+	var named []namedCondition
+	for _, name := range names {
+		if root, err := parseNamed(name, nil); err == nil {
+			named = append(named, namedCondition{name: name, root: root})
+		}
+	}
+	nodes := make([]node, len(conditions))
+	for i, t := range tokens {
+		if skip[i] {
+			continue
+		}
+		expanded, err := expand(i, t)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		root, parseErr := parse(expanded)
+		if parseErr != nil {
+			fail(located(i, parseErr))
+			continue
+		}
+		nodes[i] = root
+	}
+	return nodes, named, errs
+}
+
+// parseList parses the definition of a named list, e.g. @shells = ["bash", "sh"], into a nodeOF that matches any
+// of its strings
+func parseList(t []token) (nodeOF, error) {
+	list := t[2:]
+	if len(list) < 2 || list[0].tokenType != tokenTypeLBRACK || findToken(list, tokenTypeRBRACK) != len(list)-1 {
+		return nodeOF{}, errorAt(t[1], `strings in brackets, e.g. ["foo", "bar"]`, "invalid definition of list @%s", t[0].matched)
+	}
+	n, err := parseOf(token{tokenType: tokenTypeANY, text: t[0].text, pos: t[0].pos}, list[1:len(list)-1], true)
+	if err != nil {
+		return nodeOF{}, err
+	}
+	return n.(nodeOF), nil
+}
+
+const expectedOperand = "a string or a subcondition"
+
 func parse(tokens []token) (node, error) {
+	if len(tokens) == 0 {
+		return nil, errorAt(token{pos: position{line: 1, column: 1}}, expectedOperand, "empty condition")
+	}
+	if err := checkOperators(tokens); err != nil {
+		return nil, err
+	}
+	first := tokens[0]
 	res := make([]interface{}, len(tokens))
 	for i, token := range tokens {
 		res[i] = token
+		if token.node != nil {
+			res[i] = token.node // a reference to a named condition that is already parsed
+		}
 	}
 	// identify subexpressions with parentheses
 	for {
@@ -62,28 +495,91 @@ func parse(tokens []token) (node, error) {
 		if lPos < 0 {
 			break
 		}
-		if lPos >= len(tokens)-1 {
-			return nil, errors.New("condition ends with an opening parentheses")
-		}
 		var (
 			offset = lPos + 1
 			rPos   = findClosingPar(tokens[offset:])
 		)
 		if rPos < 0 {
-			return nil, errors.New("missing matching closing parentheses")
+			return nil, errorAt(tokens[lPos], `")"`, "missing matching closing parenthesis")
 		}
 		rPos += offset
+		if lPos >= 2 && tokens[lPos-1].tokenType == tokenTypeOF && isQuantifier(tokens[lPos-2]) {
+			// the parentheses contain the list of subexpressions of a threshold, e.g. 2 OF ("foo", "bar", "baz")
+			ofNode, err := parseOf(tokens[lPos-2], tokens[lPos+1:rPos], false)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res[:lPos-2], append([]interface{}{ofNode}, res[rPos+1:]...)...)
+			tokens = append(tokens[:lPos-2], append([]token{{tokenType: tokenTypeNONE}}, tokens[rPos+1:]...)...)
+			continue
+		}
+		if rPos == offset {
+			return nil, errorAt(tokens[rPos], expectedOperand, "empty parentheses")
+		}
 		subNode, err := parse(tokens[lPos+1 : rPos])
 		if err != nil {
-			return nil, fmt.Errorf("could not parse subexpression: %s", err)
+			return nil, err
 		}
 		res = append(res[:lPos], append([]interface{}{subNode}, res[rPos+1:]...)...)
 		tokens = append(tokens[:lPos], append([]token{{tokenType: tokenTypeNONE}}, tokens[rPos+1:]...)...)
 	}
+	// identify lists of strings, e.g. ANY OF ["foo", "bar"]
+	for {
+		lPos := findToken(tokens, tokenTypeLBRACK)
+		if lPos < 0 {
+			break
+		}
+		rPos := findToken(tokens[lPos:], tokenTypeRBRACK)
+		if rPos < 0 {
+			return nil, errorAt(tokens[lPos], `"]"`, "missing matching closing bracket")
+		}
+		rPos += lPos
+		if lPos < 2 || tokens[lPos-1].tokenType != tokenTypeOF || !isQuantifier(tokens[lPos-2]) {
+			return nil, errorAt(tokens[lPos], "ANY OF, ALL OF or N OF before the list", "unexpected list of strings")
+		}
+		ofNode, err := parseOf(tokens[lPos-2], tokens[lPos+1:rPos], true)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res[:lPos-2], append([]interface{}{ofNode}, res[rPos+1:]...)...)
+		tokens = append(tokens[:lPos-2], append([]token{{tokenType: tokenTypeNONE}}, tokens[rPos+1:]...)...)
+	}
+	// identify counts, their parameters are not nodes and have to be consumed before all other tokens
+	for i := 0; i < len(res); i++ {
+		if token, _ := res[i].(token); token.tokenType == tokenTypeCOUNT {
+			count, err := parseCount(token, res[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			res = append(res[:i+1], res[i+4:]...) // remove the parameters of the count
+			res[i] = count
+		} else if token.tokenType == tokenTypeIDENT {
+			num, params, err := parseNum(token, res[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			res = append(res[:i+1], res[i+1+params:]...) // remove the parameters of the comparison
+			res[i] = num
+		}
+	}
+	for _, elem := range res {
+		if t, ok := elem.(token); ok {
+			switch t.tokenType {
+			case tokenTypeOF, tokenTypeNUM, tokenTypeCOMMA, tokenTypeCMP, tokenTypeANY, tokenTypeALL, tokenTypeRBRACK,
+				tokenTypeLIST, tokenTypeASSIGN, tokenTypeREF, tokenTypeBETWEEN:
+				return nil, errorAt(t, "", "unexpected %s", t.text)
+			}
+		}
+	}
 	for _, tokenType := range []tokenType{
 		tokenTypeVAL,
+		tokenTypeREGEX,
+		tokenTypeWILDCARD,
+		tokenTypeNEAR,
+		tokenTypeTHEN,
 		tokenTypeNOT,
 		tokenTypeAND,
+		tokenTypeXOR,
 		tokenTypeOR,
 	} {
 		var tokenFound = true
@@ -97,16 +593,34 @@ func parse(tokens []token) (node, error) {
 				tokenFound = true
 				switch tokenType {
 				case tokenTypeVAL:
-					matched := token.matched
-					matched = strings.ToLower(matched)
-					res[i] = nodeVAL{valueNode{nodeValue: matched}}
+					if strings.Contains(token.flags, "o") {
+						return nil, errorAt(token, "", "modifier o is only allowed for counted strings")
+					}
+					res[i] = newNodeVAL(token)
+				case tokenTypeREGEX:
+					regex := nodeREGEX{valueNode{
+						nodeValue:       token.matched,
+						caseInsensitive: strings.Contains(token.flags, "i"),
+						field:           token.field,
+					}}
+					if _, err := compileRegex(regex.literal()); err != nil {
+						return nil, errorAt(token, "", "invalid regex %s: %s", regex.Condition(), err)
+					}
+					res[i] = regex
+				case tokenTypeWILDCARD:
+					res[i] = nodeWILDCARD{valueNode{
+						nodeValue:       token.matched,
+						caseInsensitive: strings.Contains(token.flags, "i"),
+						field:           token.field,
+					}}
 				default:
 					if i+1 >= len(res) {
-						return nil, fmt.Errorf("missing parameter for %s operator", tokenTypeString[tokenType])
+						return nil, errorAt(token, expectedOperand, "missing operand after %s", token.text)
 					}
 					subNode1, ok := res[i+1].(node)
 					if !ok {
-						return nil, fmt.Errorf("parameter for %s operator is not a node (1), got: %s", tokenTypeString[tokenType], res[i+1])
+						t := asToken(res[i+1])
+						return nil, errorAt(t, expectedOperand, "unexpected %s after %s", t.text, token.text)
 					}
 					res = append(res[:i+1], res[i+2:]...) // remove the (i+1)th element because it has become a sub node
 					switch tokenType {
@@ -114,20 +628,34 @@ func parse(tokens []token) (node, error) {
 						res[i] = nodeNOT{oneSubNode{node: subNode1}}
 					default:
 						if i == 0 {
-							return nil, fmt.Errorf("missing parameter for %s operator", tokenTypeString[tokenType])
+							return nil, errorAt(token, expectedOperand, "missing operand before %s", token.text)
 						}
 						subNode2, ok := res[i-1].(node)
 						if !ok {
-							return nil, fmt.Errorf("parameter for %s operator is not a node (2)", tokenTypeString[tokenType])
+							return nil, errorAt(token, expectedOperand, "unexpected %s after %s", token.text, asToken(res[i-1]).text)
 						}
 						n := twoSubNodes{subNode2, subNode1}
 						switch tokenType {
 						case tokenTypeAND:
 							res[i] = nodeAND{n}
+						case tokenTypeXOR:
+							res[i] = nodeXOR{n}
 						case tokenTypeOR:
 							res[i] = nodeOR{n}
+						case tokenTypeNEAR:
+							near, err := parseNear(token, subNode2, subNode1)
+							if err != nil {
+								return nil, err
+							}
+							res[i] = near
+						case tokenTypeTHEN:
+							then, err := parseThen(token, subNode2, subNode1)
+							if err != nil {
+								return nil, err
+							}
+							res[i] = then
 						default:
-							return nil, fmt.Errorf("invalid token type: %s", tokenTypeString[tokenType])
+							return nil, errorAt(token, "", "invalid token type: %s", tokenTypeString[tokenType])
 						}
 						res = append(res[:i-1], res[i:]...) // remove the (i-1)the element because it has become a sub node
 					}
@@ -136,14 +664,261 @@ func parse(tokens []token) (node, error) {
 			}
 		}
 	}
+	// IMPLIES has the lowest precedence and is right associative, so the last IMPLIES is merged first
+	for i := len(res) - 1; i >= 0; i-- {
+		implies := asToken(res[i])
+		if implies.tokenType != tokenTypeIMPLIES {
+			continue
+		}
+		if i == 0 {
+			return nil, errorAt(implies, expectedOperand, "missing operand before %s", implies.text)
+		}
+		if i+1 >= len(res) {
+			return nil, errorAt(implies, expectedOperand, "missing operand after %s", implies.text)
+		}
+		subNode1, ok1 := res[i-1].(node)
+		subNode2, ok2 := res[i+1].(node)
+		if !ok2 {
+			t := asToken(res[i+1])
+			return nil, errorAt(t, expectedOperand, "unexpected %s after %s", t.text, implies.text)
+		}
+		if !ok1 {
+			return nil, errorAt(implies, expectedOperand, "unexpected %s after %s", implies.text, asToken(res[i-1]).text)
+		}
+		res = append(res[:i-1], append([]interface{}{nodeIMPLIES{twoSubNodes{subNode1, subNode2}}}, res[i+2:]...)...)
+		i--
+	}
+	for _, elem := range res {
+		if t, ok := elem.(token); ok {
+			return nil, errorAt(t, "", "unexpected %s", t.text)
+		}
+	}
 	if len(res) != 1 {
-		return nil, errors.New("parse tree must have exactly one start node")
+		return nil, errorAt(first, "an operator between the subconditions", "missing operator")
+	}
+	return res[0].(node), nil
+}
+
+// asToken returns the element of a partially parsed condition as token, or an empty token if it is already a node
+func asToken(elem interface{}) token {
+	t, _ := elem.(token)
+	return t
+}
+
+// checkOperators returns an error if two operands are not separated by an operator, e.g. "foo" "bar"
+func checkOperators(tokens []token) error {
+	for i := 1; i < len(tokens); i++ {
+		switch tokens[i-1].tokenType {
+		case tokenTypeVAL, tokenTypeREGEX, tokenTypeWILDCARD, tokenTypeRPAR, tokenTypeRBRACK, tokenTypeNUM, tokenTypeREF:
+		default:
+			continue
+		}
+		switch t := tokens[i]; t.tokenType {
+		case tokenTypeVAL, tokenTypeREGEX, tokenTypeWILDCARD, tokenTypeLPAR, tokenTypeNOT, tokenTypeCOUNT, tokenTypeIDENT,
+			tokenTypeANY, tokenTypeALL, tokenTypeNUM, tokenTypeLIST, tokenTypeREF:
+			return errorAt(t, "an operator, e.g. AND", "missing operator before %s", t.text)
+		}
+	}
+	return nil
+}
+
+func newNodeVAL(t token) nodeVAL {
+	return nodeVAL{
+		valueNode: valueNode{
+			nodeValue:       t.matched,
+			caseInsensitive: strings.Contains(t.flags, "i"),
+			field:           t.field,
+		},
+		anchor: parseAnchor(t.flags),
+		word:   strings.Contains(t.flags, "w"),
+	}
+}
+
+// parseCount parses the parameters of a nodeCOUNT, e.g. "foo" >= 3
+func parseCount(t token, params []interface{}) (node, error) {
+	const expected = `a string, a comparison and a number, e.g. #"foo" >= 3`
+	var parsed [3]token
+	for i, tokenType := range []tokenType{tokenTypeVAL, tokenTypeCMP, tokenTypeNUM} {
+		if i >= len(params) {
+			return nil, errorAt(t, expected, "missing parameter for %s", t.text)
+		}
+		param, ok := params[i].(token)
+		if !ok {
+			return nil, errorAt(t, expected, "invalid parameter for %s", t.text)
+		}
+		if param.tokenType != tokenType {
+			return nil, errorAt(param, expected, "invalid parameter %s for %s", param.text, t.text)
+		}
+		parsed[i] = param
+	}
+	val, cmp, num := parsed[0], parsed[1], parsed[2]
+	comparison, err := parseComparison(cmp.matched)
+	if err != nil {
+		return nil, errorAt(cmp, "", "%s", err)
+	}
+	count, err := strconv.Atoi(num.matched)
+	if err != nil {
+		return nil, errorAt(num, "", "invalid count %s: %s", num.matched, err)
+	}
+	return nodeCOUNT{
+		val:         newNodeVAL(val),
+		comparison:  comparison,
+		count:       count,
+		overlapping: strings.Contains(val.flags, "o"),
+	}, nil
+}
+
+// parseNum parses the parameters of a nodeNUM, e.g. >= 500 or BETWEEN 1 AND 5, and returns the number of parameters
+func parseNum(field token, params []interface{}) (node, int, error) {
+	var tokens []token
+	for _, param := range params {
+		t, _ := param.(token)
+		tokens = append(tokens, t)
+		if len(tokens) == 4 {
+			break
+		}
+	}
+	parseValue := func(i int) (float64, error) {
+		if i >= len(tokens) || tokens[i].tokenType != tokenTypeNUM {
+			t := field
+			if i < len(tokens) && tokens[i].tokenType != tokenTypeNONE {
+				t = tokens[i]
+			}
+			return 0, errorAt(t, "a number", "comparison of field %s requires a number", field.matched)
+		}
+		value, err := strconv.ParseFloat(tokens[i].matched, 64)
+		if err != nil {
+			return 0, errorAt(tokens[i], "", "invalid number %s: %s", tokens[i].matched, err)
+		}
+		return value, nil
+	}
+	if len(tokens) >= 1 && tokens[0].tokenType == tokenTypeCMP {
+		comparison, err := parseComparison(tokens[0].matched)
+		if err != nil {
+			return nil, 0, errorAt(tokens[0], "", "%s", err)
+		}
+		value, err := parseValue(1)
+		if err != nil {
+			return nil, 0, err
+		}
+		return nodeNUM{field: field.matched, comparison: comparison, value: value}, 2, nil
+	}
+	if len(tokens) >= 1 && tokens[0].tokenType == tokenTypeBETWEEN {
+		min, err := parseValue(1)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(tokens) < 3 || tokens[2].tokenType != tokenTypeAND {
+			return nil, 0, errorAt(tokens[1], "AND after the lower bound", "incomplete range of field %s", field.matched)
+		}
+		max, err := parseValue(3)
+		if err != nil {
+			return nil, 0, err
+		}
+		if min > max {
+			return nil, 0, errorAt(field, "", "invalid range of field %s: %s is greater than %s", field.matched, tokens[1].matched, tokens[3].matched)
+		}
+		return nodeNUM{field: field.matched, value: min, max: max, between: true}, 4, nil
+	}
+	return nil, 0, errorAt(field, fmt.Sprintf("a comparison, e.g. %s >= 500 or %s BETWEEN 1 AND 5", field.matched, field.matched), "unexpected %s", field.text)
+}
+
+// parseNear parses the operands of a nodeNEAR, both operands have to be strings
+func parseNear(t token, operand1, operand2 node) (node, error) {
+	val1, ok1 := operand1.(nodeVAL)
+	val2, ok2 := operand2.(nodeVAL)
+	if !ok1 || !ok2 {
+		return nil, errorAt(t, `two strings, e.g. "foo" NEAR/5 "bar"`, "%s requires two strings", t.text)
+	}
+	if val1.field != val2.field {
+		return nil, errorAt(t, "", "%s requires two strings of the same field", t.text)
+	}
+	gap, err := parseGap(t)
+	if err != nil {
+		return nil, err
+	}
+	return nodeNEAR{val1: val1, val2: val2, gap: gap}, nil
+}
+
+// parseThen parses the operands of a nodeTHEN, operands that are nodeTHENs themselves are merged into one sequence
+func parseThen(t token, operand1, operand2 node) (node, error) {
+	gap, err := parseGap(t)
+	if err != nil {
+		return nil, err
 	}
-	startNode, ok := res[0].(node)
-	if !ok {
-		return nil, errors.New("start node is not a node")
+	var then nodeTHEN
+	for i, operand := range []node{operand1, operand2} {
+		if i > 0 {
+			then.gaps = append(then.gaps, gap)
+		}
+		switch v := operand.(type) {
+		case nodeVAL:
+			then.vals = append(then.vals, v)
+		case nodeTHEN:
+			then.vals = append(then.vals, v.vals...)
+			then.gaps = append(then.gaps, v.gaps...)
+		default:
+			return nil, errorAt(t, `strings, e.g. "foo" THEN "bar"`, "%s requires strings", t.text)
+		}
 	}
-	return startNode, nil
+	for _, val := range then.vals[1:] {
+		if val.field != then.vals[0].field {
+			return nil, errorAt(t, "", "%s requires strings of the same field", t.text)
+		}
+	}
+	return then, nil
+}
+
+// isQuantifier returns true if the token can be the threshold of an OF, i.e. a number, ANY or ALL
+func isQuantifier(t token) bool {
+	return t.tokenType == tokenTypeNUM || t.tokenType == tokenTypeANY || t.tokenType == tokenTypeALL
+}
+
+// parseOf parses the list of a threshold, the quantifier is a number, ANY or ALL. Lists in brackets may only
+// contain strings.
+func parseOf(quantifier token, list []token, onlyStrings bool) (node, error) {
+	var nodes []node
+	for len(list) > 0 {
+		elem := list
+		list = nil
+		if comma := findListSeparator(elem); comma >= 0 {
+			if comma == 0 {
+				return nil, errorAt(elem[0], "a list element", "missing list element")
+			}
+			if comma == len(elem)-1 {
+				return nil, errorAt(elem[comma], "a list element", "list ends with a comma")
+			}
+			elem, list = elem[:comma], elem[comma+1:]
+		}
+		subNode, err := parse(elem)
+		if err != nil {
+			return nil, err
+		}
+		if onlyStrings {
+			switch subNode.(type) {
+			case nodeVAL, nodeREGEX, nodeWILDCARD:
+			default:
+				return nil, errorAt(elem[0], "a string", "list in brackets may only contain strings, got: %s", subNode.Condition())
+			}
+		}
+		nodes = append(nodes, subNode)
+	}
+	var n int
+	switch quantifier.tokenType {
+	case tokenTypeANY:
+		n = 1
+	case tokenTypeALL:
+		n = len(nodes)
+	default:
+		var err error
+		if n, err = strconv.Atoi(quantifier.matched); err != nil {
+			return nil, errorAt(quantifier, "", "invalid threshold %s: %s", quantifier.matched, err)
+		}
+	}
+	if n < 1 || n > len(nodes) {
+		return nil, errorAt(quantifier, "", "threshold must be between 1 and %d, got: %d", len(nodes), n)
+	}
+	return nodeOF{multiSubNodes: multiSubNodes{nodes: nodes}, min: n}, nil
 }
 
 func (n nodeAND) Condition() string {
@@ -155,7 +930,117 @@ func (n nodeOR) Condition() string {
 }
 
 func (n nodeVAL) Condition() string {
-	return strconv.Quote(n.nodeValue)
+	return n.literal().quote(n.nodeValue, "")
+}
+
+// literal returns the string that has to be searched for this value, case insensitive strings are lowercased
+func (n nodeVAL) literal() literal {
+	if n.caseInsensitive {
+		return literal{str: strings.ToLower(n.nodeValue), caseInsensitive: true, anchor: n.anchor, word: n.word, field: n.field}
+	}
+	return literal{str: n.nodeValue, anchor: n.anchor, word: n.word, field: n.field}
+}
+
+func (n nodeREGEX) Condition() string {
+	return n.literal().quote(n.nodeValue, "")
+}
+
+func (n nodeREGEX) literal() literal {
+	return literal{kind: literalRegex, str: n.nodeValue, caseInsensitive: n.caseInsensitive, field: n.field}
+}
+
+func (n nodeWILDCARD) Condition() string {
+	return n.literal().quote(n.nodeValue, "")
+}
+
+func (n nodeWILDCARD) literal() literal {
+	if n.caseInsensitive {
+		return literal{kind: literalWildcard, str: strings.ToLower(n.nodeValue), caseInsensitive: true, field: n.field}
+	}
+	return literal{kind: literalWildcard, str: n.nodeValue, field: n.field}
+}
+
+func (n nodeCOUNT) Condition() string {
+	var flags string
+	if n.overlapping {
+		flags = "o"
+	}
+	return fmt.Sprintf("#%s %s %d", n.val.literal().quote(n.val.nodeValue, flags), n.comparison, n.count)
+}
+
+// literal of a nodeCOUNT is its condition, it is verified by counting the occurrences of its string
+func (n nodeCOUNT) literal() literal {
+	return literal{kind: literalCount, str: n.Condition(), field: n.val.field}
+}
+
+func (n nodeNUM) Condition() string {
+	if n.between {
+		return fmt.Sprintf("%s BETWEEN %s AND %s", n.field, formatNum(n.value), formatNum(n.max))
+	}
+	return fmt.Sprintf("%s %s %s", n.field, n.comparison, formatNum(n.value))
+}
+
+// literal of a nodeNUM is its condition, it is verified with the numeric value of its field
+func (n nodeNUM) literal() literal {
+	return literal{kind: literalNum, str: n.Condition(), field: n.field}
+}
+
+// matches returns true if the value satisfies the comparison
+func (n nodeNUM) matches(value float64) bool {
+	if n.between {
+		return value >= n.value && value <= n.max
+	}
+	return n.comparison.compare(value, n.value)
+}
+
+func formatNum(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func (n nodeNEAR) Condition() string {
+	return fmt.Sprintf("%s NEAR%s %s", n.val1.Condition(), n.gap, n.val2.Condition())
+}
+
+func (n nodeTHEN) Condition() string {
+	var b strings.Builder
+	for i, val := range n.vals {
+		if i > 0 {
+			fmt.Fprintf(&b, " THEN%s ", n.gaps[i-1])
+		}
+		b.WriteString(val.Condition())
+	}
+	return b.String()
+}
+
+// literal of a nodeTHEN is its condition, it is verified with the positions of all strings
+func (n nodeTHEN) literal() literal {
+	return literal{kind: literalThen, str: n.Condition(), field: n.vals[0].field}
+}
+
+// literal of a nodeNEAR is its condition, it is verified with the positions of both strings
+func (n nodeNEAR) literal() literal {
+	return literal{kind: literalNear, str: n.Condition(), field: n.val1.field}
+}
+
+func (n nodeOF) Condition() string {
+	subNodes := make([]string, len(n.nodes))
+	for i, subNode := range n.nodes {
+		subNodes[i] = subNode.Condition()
+	}
+	return fmt.Sprintf("%d OF (%s)", n.min, strings.Join(subNodes, ", "))
+}
+
+// literal of a nodeOF is its condition, it is verified by counting its matching sub nodes
+func (n nodeOF) literal() literal {
+	return literal{kind: literalOf, str: n.Condition()}
+}
+
+func (n nodeXOR) Condition() string {
+	return fmt.Sprintf("(%s XOR %s)", n.node1.Condition(), n.node2.Condition())
+}
+
+func (n nodeIMPLIES) Condition() string {
+	return fmt.Sprintf("(%s IMPLIES %s)", n.node1.Condition(), n.node2.Condition())
 }
 
 func (n nodeNOT) Condition() string {
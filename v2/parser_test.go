@@ -20,6 +20,17 @@ func Example_parse() {
 	p(`"foo" AND NOT "bar"`)
 	p(`"foo" AND NOT ("bar" OR "baz")`)
 	p(`("foo" OR "bar") AND ("bar" OR "baz") AND ("baaz" OR "qux")`)
+	p(`"Foo"i AND "Bar"`)
+	p(`^"GET "i AND ".exe"$ AND ="admin" AND ^"root"$`)
+	p(`"root"w OR "Root"iw$`)
+	p(`"foo" AND 2 OF ("bar", ("baz" OR "qux"), NOT "quux")`)
+	p(`#"foo" >= 3 AND NOT #"bar"io<2`)
+	p(`NOT "foo" near/5 "bar"i OR "baz"w NEAR/2w ^"qux"`)
+	p(`"foo" THEN "bar" then/3w ("baz" THEN/10 "qux") AND "quux"`)
+	p(`"a" OR "b" XOR NOT "c" AND "d" -> "e" IMPLIES "f"`)
+	p(`ANY OF ["a", /b/, w"c*"] AND NOT all of ("d"i, "e" OR "f")`)
+	p(`user:^"root"iw AND #cmd:"-"o > 3 AND host:/^srv\d+/ AND msg:"a" THEN msg:"b"`)
+	p(`status >= 500 AND NOT duration between 0.5 and 5 OR bytes!=-1`)
 	// Output:
 	// ----- "foo" -----
 	// nodeVAL{"foo"}
@@ -31,6 +42,28 @@ func Example_parse() {
 	// nodeAND{nodeVAL{"foo"},nodeNOT{nodeOR{nodeVAL{"bar"},nodeVAL{"baz"}}}}
 	// ----- ("foo" OR "bar") AND ("bar" OR "baz") AND ("baaz" OR "qux") -----
 	// nodeAND{nodeAND{nodeOR{nodeVAL{"foo"},nodeVAL{"bar"}},nodeOR{nodeVAL{"bar"},nodeVAL{"baz"}}},nodeOR{nodeVAL{"baaz"},nodeVAL{"qux"}}}
+	// ----- "Foo"i AND "Bar" -----
+	// nodeAND{nodeVAL{"Foo"i},nodeVAL{"Bar"}}
+	// ----- ^"GET "i AND ".exe"$ AND ="admin" AND ^"root"$ -----
+	// nodeAND{nodeAND{nodeVAL{^"GET "i},nodeVAL{".exe"$}},nodeAND{nodeVAL{="admin"},nodeVAL{="root"}}}
+	// ----- "root"w OR "Root"iw$ -----
+	// nodeOR{nodeVAL{"root"w},nodeVAL{"Root"iw$}}
+	// ----- "foo" AND 2 OF ("bar", ("baz" OR "qux"), NOT "quux") -----
+	// nodeAND{nodeVAL{"foo"},nodeOF{2,nodeVAL{"bar"},nodeOR{nodeVAL{"baz"},nodeVAL{"qux"}},nodeNOT{nodeVAL{"quux"}}}}
+	// ----- #"foo" >= 3 AND NOT #"bar"io<2 -----
+	// nodeAND{nodeCOUNT{#"foo" >= 3},nodeNOT{nodeCOUNT{#"bar"io < 2}}}
+	// ----- NOT "foo" near/5 "bar"i OR "baz"w NEAR/2w ^"qux" -----
+	// nodeOR{nodeNOT{nodeNEAR{"foo" NEAR/5 "bar"i}},nodeNEAR{"baz"w NEAR/2W ^"qux"}}
+	// ----- "foo" THEN "bar" then/3w ("baz" THEN/10 "qux") AND "quux" -----
+	// nodeAND{nodeTHEN{"foo" THEN "bar" THEN/3W "baz" THEN/10 "qux"},nodeVAL{"quux"}}
+	// ----- "a" OR "b" XOR NOT "c" AND "d" -> "e" IMPLIES "f" -----
+	// nodeIMPLIES{nodeOR{nodeVAL{"a"},nodeXOR{nodeVAL{"b"},nodeAND{nodeNOT{nodeVAL{"c"}},nodeVAL{"d"}}}},nodeIMPLIES{nodeVAL{"e"},nodeVAL{"f"}}}
+	// ----- ANY OF ["a", /b/, w"c*"] AND NOT all of ("d"i, "e" OR "f") -----
+	// nodeAND{nodeOF{1,nodeVAL{"a"},nodeREGEX{/b/},nodeWILDCARD{w"c*"}},nodeNOT{nodeOF{2,nodeVAL{"d"i},nodeOR{nodeVAL{"e"},nodeVAL{"f"}}}}}
+	// ----- user:^"root"iw AND #cmd:"-"o > 3 AND host:/^srv\d+/ AND msg:"a" THEN msg:"b" -----
+	// nodeAND{nodeAND{nodeVAL{user:^"root"iw},nodeCOUNT{#cmd:"-"o > 3}},nodeAND{nodeREGEX{host:/^srv\d+/},nodeTHEN{msg:"a" THEN msg:"b"}}}
+	// ----- status >= 500 AND NOT duration between 0.5 and 5 OR bytes!=-1 -----
+	// nodeOR{nodeAND{nodeNUM{status >= 500},nodeNOT{nodeNUM{duration BETWEEN 0.5 AND 5}}},nodeNUM{bytes != -1}}
 }
 
 func Example_parse_multi() {
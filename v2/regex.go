@@ -0,0 +1,125 @@
+package evalostic
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// maxPrefilterAlternatives limits the number of alternatives that are extracted from a single regex,
+// regexes with more alternatives will only be prefiltered by a subset of their required strings or not at all
+const maxPrefilterAlternatives = 16
+
+func compileRegex(l literal) (*regexp.Regexp, error) {
+	if l.caseInsensitive {
+		return regexp.Compile("(?i)" + l.str)
+	}
+	return regexp.Compile(l.str)
+}
+
+func mustCompileRegex(l literal) *regexp.Regexp {
+	re, err := compileRegex(l)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// quoteRegex returns the regex in the /pattern/ notation of a condition
+func quoteRegex(pattern string) string {
+	return "/" + strings.ReplaceAll(pattern, "/", `\/`) + "/"
+}
+
+// unquoteRegex removes the escaping of slashes inside the /pattern/ notation of a condition
+func unquoteRegex(quoted string) string {
+	return strings.ReplaceAll(quoted, `\/`, "/")
+}
+
+// regexPrefilter returns alternatives of strings that are required for a match of the regex, e.g.
+// /foo(bar|baz)+/ requires "foo" and "bar" or "foo" and "baz". Case insensitive parts of the regex
+// result in lowercased case insensitive strings. A nil result means that no strings are required.
+func regexPrefilter(l literal) [][]literal {
+	flags := syntax.Perl
+	if l.caseInsensitive {
+		flags |= syntax.FoldCase
+	}
+	re, err := syntax.Parse(l.str, flags)
+	if err != nil {
+		return nil
+	}
+	return requiredLiterals(re.Simplify())
+}
+
+func requiredLiterals(re *syntax.Regexp) [][]literal {
+	switch re.Op {
+	case syntax.OpLiteral:
+		str := string(re.Rune)
+		if re.Flags&syntax.FoldCase == 0 {
+			return [][]literal{{{str: str}}}
+		}
+		if !lowerFoldsRunes(re.Rune) {
+			return nil // the lowercased string would not find all case insensitive matches
+		}
+		return [][]literal{{{str: strings.ToLower(str), caseInsensitive: true}}}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min < 1 {
+			return nil
+		}
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpConcat:
+		var res [][]literal
+		for _, sub := range re.Sub {
+			subRes := requiredLiterals(sub)
+			if subRes == nil {
+				continue
+			}
+			if res == nil {
+				res = subRes
+				continue
+			}
+			if len(res)*len(subRes) > maxPrefilterAlternatives {
+				continue // skipping a required part only weakens the prefilter
+			}
+			var combined [][]literal
+			for _, alternative := range res {
+				for _, subAlternative := range subRes {
+					combined = append(combined, append(append([]literal{}, alternative...), subAlternative...))
+				}
+			}
+			res = combined
+		}
+		return res
+	case syntax.OpAlternate:
+		var res [][]literal
+		for _, sub := range re.Sub {
+			subRes := requiredLiterals(sub)
+			if subRes == nil {
+				return nil // this alternative can match without any string
+			}
+			res = append(res, subRes...)
+		}
+		if len(res) > maxPrefilterAlternatives {
+			return nil
+		}
+		return res
+	default:
+		return nil
+	}
+}
+
+// lowerFoldsRunes checks that all case variants of the runes are lowercased to the same rune, this is
+// not the case for e.g. the long s "ſ", which would be missed when searching for "s" in a lowercased string.
+func lowerFoldsRunes(runes []rune) bool {
+	for _, r := range runes {
+		lower := unicode.ToLower(r)
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if unicode.ToLower(f) != lower {
+				return false
+			}
+		}
+	}
+	return true
+}
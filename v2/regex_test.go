@@ -0,0 +1,42 @@
+package evalostic
+
+import "fmt"
+
+func Example_regexPrefilter() {
+	rp := func(cond string) {
+		root, err := parseCondition(cond)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("----- %s -----\n", cond)
+		fmt.Println(regexPrefilter(root.(nodeREGEX).literal()))
+	}
+	rp(`/foo/`)
+	rp(`/foo\d+bar/`)
+	rp(`/foo(bar|qux)+/`)
+	rp(`/foo(bar|baz)?/`)
+	rp(`/(foo|\d+)/`)
+	rp(`/\w+@corp\.com/i`)
+	rp(`/FOO(?i:Bar)/`)
+	rp(`/a\/b/`)
+	rp(`/\d+/`)
+	// Output:
+	// ----- /foo/ -----
+	// [["foo"]]
+	// ----- /foo\d+bar/ -----
+	// [["foo" "bar"]]
+	// ----- /foo(bar|qux)+/ -----
+	// [["foo" "bar"] ["foo" "qux"]]
+	// ----- /foo(bar|baz)?/ -----
+	// [["foo"]]
+	// ----- /(foo|\d+)/ -----
+	// []
+	// ----- /\w+@corp\.com/i -----
+	// [["@corp.com"i]]
+	// ----- /FOO(?i:Bar)/ -----
+	// [["FOO" "bar"i]]
+	// ----- /a\/b/ -----
+	// [["a/b"]]
+	// ----- /\d+/ -----
+	// []
+}
@@ -0,0 +1,465 @@
+package evalostic
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// simplifyMaxAtoms is the maximum number of distinct strings of a condition that is minimized with the Quine-McCluskey
+// algorithm, whose truth table grows exponentially with the strings
+const simplifyMaxAtoms = 10
+
+// Simplify parses the condition and returns an equivalent condition with less redundancy in the notation of Format.
+// Double negations, duplicate operands and operands that are absorbed by others, e.g. "a" OR ("a" AND "b"), are
+// removed, as well as sub conditions that always match or never match. Conditions with at most 10 distinct strings
+// are minimized to the shortest sum of products if it has fewer strings than the condition. A condition that never
+// matches is returned as "a" AND NOT "a" and a condition that always matches as "a" OR NOT "a", where "a" is its first
+// string. Regexes, wildcards, counts, NEAR, THEN and numeric comparisons are treated as strings, the elements of
+// thresholds are simplified separately. Like Format, Simplify does not resolve references.
+func Simplify(condition string) (string, error) {
+	return rewrite(condition, "simplify", simplify)
+}
+
+// simplify returns an equivalent node with less redundancy
+func simplify(n node) node {
+	n = simplifyThresholds(n)
+	s := newSimplifier(n)
+	reduced, root := s.reduce(n)
+	switch root {
+	case bddFalse:
+		return nodeAND{twoSubNodes{node1: s.leaves[0], node2: nodeNOT{oneSubNode{node: s.leaves[0]}}}}
+	case bddTrue:
+		return nodeOR{twoSubNodes{node1: s.leaves[0], node2: nodeNOT{oneSubNode{node: s.leaves[0]}}}}
+	}
+	if len(s.leaves) <= simplifyMaxAtoms {
+		if minimized := s.minimize(root); countLeaves(minimized) < countLeaves(reduced) {
+			return minimized
+		}
+	}
+	return reduced
+}
+
+// simplifyThresholds simplifies the sub nodes of all thresholds of the node
+func simplifyThresholds(n node) node {
+	switch v := n.(type) {
+	case nodeOF:
+		nodes := make([]node, len(v.nodes))
+		for i, subNode := range v.nodes {
+			nodes[i] = simplify(subNode)
+		}
+		v.nodes = nodes
+		return v
+	case nodeAND:
+		v.node1, v.node2 = simplifyThresholds(v.node1), simplifyThresholds(v.node2)
+		return v
+	case nodeOR:
+		v.node1, v.node2 = simplifyThresholds(v.node1), simplifyThresholds(v.node2)
+		return v
+	case nodeXOR:
+		v.node1, v.node2 = simplifyThresholds(v.node1), simplifyThresholds(v.node2)
+		return v
+	case nodeIMPLIES:
+		v.node1, v.node2 = simplifyThresholds(v.node1), simplifyThresholds(v.node2)
+		return v
+	case nodeNOT:
+		v.node = simplifyThresholds(v.node)
+		return v
+	default:
+		return n
+	}
+}
+
+// simplifier reduces the boolean structure of a condition, the BDD of the condition detects operands that never
+// match, always match or are implied by other operands
+type simplifier struct {
+	bdd    *bdd
+	atoms  map[literal]int // variable of each leaf in the BDD
+	leaves []leaf          // leaves in order of their first occurrence
+}
+
+// newSimplifier returns a simplifier whose BDD contains the leaves of all nodes, thresholds are built from the leaves
+// of their sub nodes
+func newSimplifier(nodes ...node) *simplifier {
+	s := &simplifier{bdd: newBDD(), atoms: make(map[literal]int)}
+	s.bdd.thresholds = true
+	var collect func(n node)
+	collect = func(n node) {
+		if _, ok := n.(nodeOF); ok {
+			for _, subNode := range n.Children() {
+				collect(subNode)
+			}
+			return
+		}
+		if l, ok := n.(leaf); ok {
+			if _, ok := s.atoms[l.literal()]; !ok {
+				s.atoms[l.literal()] = len(s.leaves)
+				s.leaves = append(s.leaves, l)
+			}
+			return
+		}
+		for _, subNode := range n.Children() {
+			collect(subNode)
+		}
+	}
+	for _, n := range nodes {
+		collect(n)
+	}
+	return s
+}
+
+// implies returns true if the BDD x never matches without y
+func (s *simplifier) implies(x, y int) bool {
+	return s.bdd.apply(bddAND, x, s.bdd.apply(bddXOR, y, bddTrue)) == bddFalse
+}
+
+// reduce returns the reduced node and the root of its BDD, the node is nil if the root is a terminal
+func (s *simplifier) reduce(n node) (node, int) {
+	root := s.bdd.build(n, s.atoms)
+	if root <= bddTrue {
+		return nil, root
+	}
+	switch v := n.(type) {
+	case nodeAND:
+		return s.reduceChain(flattenAnd(v), bddAND), root
+	case nodeOR:
+		return s.reduceChain(flattenOr(v), bddOR), root
+	case nodeXOR:
+		x, rootX := s.reduce(v.node1)
+		y, rootY := s.reduce(v.node2)
+		switch {
+		case rootX == bddFalse:
+			return y, root
+		case rootY == bddFalse:
+			return x, root
+		case rootX == bddTrue:
+			return negate(y), root
+		case rootY == bddTrue:
+			return negate(x), root
+		}
+		v.node1, v.node2 = x, y
+		return v, root
+	case nodeIMPLIES:
+		// node1 never matches and node2 always matches are impossible, because the root would be true
+		x, rootX := s.reduce(v.node1)
+		y, rootY := s.reduce(v.node2)
+		switch {
+		case rootX == bddTrue:
+			return y, root
+		case rootY == bddFalse:
+			return negate(x), root
+		}
+		v.node1, v.node2 = x, y
+		return v, root
+	case nodeNOT:
+		x, _ := s.reduce(v.node)
+		return negate(x), root
+	default:
+		return n, root
+	}
+}
+
+// reduceChain returns the reduced operands of an AND or an OR joined by the operator. Operands that always match in
+// an AND or never match in an OR are removed, the root of the chain would be a terminal if an operand never matches
+// in an AND or always matches in an OR. Equivalent operands are removed as well as operands that are implied by
+// another operand in an AND or imply another operand in an OR.
+func (s *simplifier) reduceChain(operands []node, operator bddOperator) node {
+	identity := bddTrue
+	if operator == bddOR {
+		identity = bddFalse
+	}
+	var nodes []node
+	var roots []int
+	seen := make(map[int]struct{})
+	for _, operand := range operands {
+		reduced, root := s.reduce(operand)
+		if root == identity {
+			continue
+		}
+		subNodes := []node{reduced}
+		switch v := reduced.(type) {
+		case nodeAND:
+			if operator == bddAND {
+				subNodes = flattenAnd(v)
+			}
+		case nodeOR:
+			if operator == bddOR {
+				subNodes = flattenOr(v)
+			}
+		}
+		for _, subNode := range subNodes {
+			subRoot := s.bdd.build(subNode, s.atoms)
+			if _, ok := seen[subRoot]; ok {
+				continue
+			}
+			seen[subRoot] = struct{}{}
+			nodes, roots = append(nodes, subNode), append(roots, subRoot)
+		}
+	}
+	removed := make([]bool, len(nodes))
+	for i := range nodes {
+		for j := range nodes {
+			if i == j || removed[j] {
+				continue
+			}
+			if operator == bddAND && s.implies(roots[j], roots[i]) || operator == bddOR && s.implies(roots[i], roots[j]) {
+				removed[i] = true
+				break
+			}
+		}
+	}
+	var res node
+	for i, n := range nodes {
+		switch {
+		case removed[i]:
+		case res == nil:
+			res = n
+		case operator == bddAND:
+			res = nodeAND{twoSubNodes{node1: res, node2: n}}
+		default:
+			res = nodeOR{twoSubNodes{node1: res, node2: n}}
+		}
+	}
+	return res
+}
+
+// negate returns the negation of the node without a double negation
+func negate(n node) node {
+	if not, ok := n.(nodeNOT); ok {
+		return not.node
+	}
+	return nodeNOT{oneSubNode{node: n}}
+}
+
+// implicant is a product of the leaves of a simplifier, the bits of mask are the leaves that are not part of the
+// product and the other bits of value are the leaves that have to be found
+type implicant struct {
+	value, mask uint32
+}
+
+func (i implicant) covers(minterm uint32) bool {
+	return minterm&^i.mask == i.value
+}
+
+// minimize returns the shortest sum of products of the BDD with the Quine-McCluskey algorithm, the prime implicants
+// that cover all minterms are chosen greedily after the essential prime implicants
+func (s *simplifier) minimize(root int) node {
+	var minterms []uint32
+	for m := uint32(0); m < 1<<uint(len(s.leaves)); m++ {
+		i := root
+		for i > bddTrue {
+			n := s.bdd.nodes[i]
+			if m&(1<<uint(n.variable)) != 0 {
+				i = n.high
+			} else {
+				i = n.low
+			}
+		}
+		if i == bddTrue {
+			minterms = append(minterms, m)
+		}
+	}
+	cover := coverMinterms(primeImplicants(minterms, len(s.leaves)), minterms)
+	var res node
+	for _, product := range cover {
+		var and node
+		for i, l := range s.leaves {
+			if product.mask&(1<<uint(i)) != 0 {
+				continue
+			}
+			var n node = l
+			if product.value&(1<<uint(i)) == 0 {
+				n = nodeNOT{oneSubNode{node: l}}
+			}
+			if and == nil {
+				and = n
+			} else {
+				and = nodeAND{twoSubNodes{node1: and, node2: n}}
+			}
+		}
+		if res == nil {
+			res = and
+		} else {
+			res = nodeOR{twoSubNodes{node1: res, node2: and}}
+		}
+	}
+	return res
+}
+
+// primeImplicants combines the minterms of n variables to implicants until they can not be combined anymore
+func primeImplicants(minterms []uint32, n int) (primes []implicant) {
+	current := make(map[implicant]bool) // true if the implicant was combined with another one
+	for _, m := range minterms {
+		current[implicant{value: m}] = false
+	}
+	for len(current) > 0 {
+		next := make(map[implicant]bool)
+		for i := range current {
+			for bit := uint32(1); bit < 1<<uint(n); bit <<= 1 {
+				if i.mask&bit != 0 || i.value&bit != 0 {
+					continue
+				}
+				other := implicant{value: i.value | bit, mask: i.mask}
+				if _, ok := current[other]; ok {
+					current[i], current[other] = true, true
+					next[implicant{value: i.value, mask: i.mask | bit}] = false
+				}
+			}
+		}
+		for i, combined := range current {
+			if !combined {
+				primes = append(primes, i)
+			}
+		}
+		current = next
+	}
+	sort.Slice(primes, func(i, j int) bool {
+		return primes[i].less(primes[j], n)
+	})
+	return
+}
+
+// less orders implicants by their first variable, products that contain it come first and positive ones before
+// negated ones
+func (i implicant) less(other implicant, n int) bool {
+	order := func(i implicant, bit uint32) int {
+		switch {
+		case i.mask&bit != 0:
+			return 2
+		case i.value&bit != 0:
+			return 0
+		default:
+			return 1
+		}
+	}
+	for bit := uint32(1); bit < 1<<uint(n); bit <<= 1 {
+		if o1, o2 := order(i, bit), order(other, bit); o1 != o2 {
+			return o1 < o2
+		}
+	}
+	return false
+}
+
+// coverMinterms returns the prime implicants that cover all minterms, the essential prime implicants that are the only
+// ones which cover a minterm are chosen first and then the ones that cover the most remaining minterms
+func coverMinterms(primes []implicant, minterms []uint32) (cover []implicant) {
+	uncovered := make(map[uint32]struct{}, len(minterms))
+	for _, m := range minterms {
+		uncovered[m] = struct{}{}
+	}
+	used := make([]bool, len(primes))
+	choose := func(i int) {
+		used[i] = true
+		for m := range uncovered {
+			if primes[i].covers(m) {
+				delete(uncovered, m)
+			}
+		}
+	}
+	for _, m := range minterms {
+		only := -1
+		for i, p := range primes {
+			if p.covers(m) {
+				if only >= 0 {
+					only = -1
+					break
+				}
+				only = i
+			}
+		}
+		if only >= 0 && !used[only] {
+			choose(only)
+		}
+	}
+	for len(uncovered) > 0 {
+		best, bestCount := -1, 0
+		for i, p := range primes {
+			if used[i] {
+				continue
+			}
+			var count int
+			for m := range uncovered {
+				if p.covers(m) {
+					count++
+				}
+			}
+			if count > bestCount || count == bestCount && count > 0 && bits.OnesCount32(p.mask) > bits.OnesCount32(primes[best].mask) {
+				best, bestCount = i, count
+			}
+		}
+		choose(best)
+	}
+	for i, p := range primes {
+		if used[i] {
+			cover = append(cover, p)
+		}
+	}
+	return
+}
+
+// countLeaves returns the number of leaves of the boolean structure of the node
+func countLeaves(n node) int {
+	if _, ok := n.(leaf); ok {
+		return 1
+	}
+	var count int
+	for _, subNode := range n.Children() {
+		count += countLeaves(subNode)
+	}
+	return count
+}
+
+// simplifyAndPaths removes duplicate literals of the and-paths and the and-paths that never match, because they
+// contain a literal and its negation, or that are subsumed by another and-path, whose literals they all contain
+func simplifyAndPaths(paths []andPath) []andPath {
+	var res []andPath
+	var sets []map[andString]struct{}
+	for _, path := range paths {
+		set := make(map[andString]struct{}, len(path))
+		unique := make(andPath, 0, len(path))
+		contradiction := false
+		for _, str := range path {
+			if _, ok := set[andString{not: !str.not, literal: str.literal}]; ok {
+				contradiction = true
+				break
+			}
+			if _, ok := set[str]; !ok {
+				set[str] = struct{}{}
+				unique = append(unique, str)
+			}
+		}
+		if !contradiction {
+			res, sets = append(res, unique), append(sets, set)
+		}
+	}
+	// shorter and-paths are checked first, so that every and-path is only removed because of an and-path that is kept
+	indices := make([]int, len(res))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool { return len(res[indices[i]]) < len(res[indices[j]]) })
+	var kept []int
+	for _, i := range indices {
+		subsumed := false
+		for _, k := range kept {
+			subsumed = true
+			for str := range sets[k] {
+				if _, ok := sets[i][str]; !ok {
+					subsumed = false
+					break
+				}
+			}
+			if subsumed {
+				break
+			}
+		}
+		if !subsumed {
+			kept = append(kept, i)
+		}
+	}
+	sort.Ints(kept)
+	simplified := make([]andPath, len(kept))
+	for j, i := range kept {
+		simplified[j] = res[i]
+	}
+	return simplified
+}
@@ -0,0 +1,89 @@
+package evalostic
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	for _, tc := range []struct {
+		condition  string
+		simplified string
+	}{
+		{`"a" OR ("a" AND "b")`, `"a"`},
+		{`"a" AND ("b" AND "a")`, `"a" AND "b"`},
+		{`not (not "a") and "b"i and "B"i`, `"a" AND "b"i`},
+		{`"a" AND NOT "a"`, `"a" AND NOT "a"`},
+		{`"b" AND ("a" AND NOT "a" OR "c")`, `"b" AND "c"`},
+		{`"a" -> ("b" OR NOT "b")`, `"a" OR NOT "a"`},
+		{`"a" XOR ("b" AND NOT "b")`, `"a"`},
+		{`("a" OR "b") AND ("a" OR NOT "b")`, `"a"`},
+		{`("a" OR "b") AND ("c" OR "d")`, `("a" OR "b") AND ("c" OR "d")`},
+		{`"a" AND "b" OR "a" AND NOT "b" OR "c"`, `"a" OR "c"`},
+		{`"a" AND "b" AND "c" OR "a" AND "b" AND NOT "c" OR "a" AND NOT "b" AND "c" OR NOT "a" AND "b" AND "c"`, `"a" AND "b" OR "a" AND "c" OR "b" AND "c"`},
+		{`2 OF ("a" OR "a", "b", "c") AND ($x OR $x)`, `2 OF ("a", "b", "c") AND $x`},
+		{`$n = "x" AND ("x" OR "y")`, `$n = "x"`},
+		{`ANY OF ("a", "b") OR "a"`, `ANY OF ("a", "b")`},
+		{`2 OF ("a", "b") AND "a" AND "b"`, `ALL OF ("a", "b")`},
+		{`#"x" > 2 OR NOT (#"x" > 2 OR status >= 500)`, `#"x" > 2 OR NOT status >= 500`},
+		{``, ``},
+	} {
+		simplified, err := Simplify(tc.condition)
+		if err != nil {
+			t.Fatalf("%s: %s", tc.condition, err)
+		}
+		if simplified != tc.simplified {
+			t.Errorf("%s: expected %s, got %s", tc.condition, tc.simplified, simplified)
+		}
+	}
+	_, err := Simplify(`"a" AND`)
+	assertTrue(t, err != nil && strings.HasPrefix(err.Error(), "could not simplify condition"))
+}
+
+func TestSimplify_randomConditions(t *testing.T) {
+	rand.Seed(0)
+	for i := 0; i < 200; i++ {
+		condition := randomCondition(4)
+		simplified, err := Simplify(condition)
+		if err != nil {
+			t.Fatalf("%s: %s", condition, err)
+		}
+		root1, _ := parseCondition(condition)
+		root2, err := parseCondition(simplified)
+		assertTrue(t, err == nil && countLeaves(root2) <= countLeaves(root1))
+		e, err := New([]string{condition, simplified})
+		assertTrue(t, err == nil)
+		for j := 0; j < 20; j++ {
+			var s string
+			for _, str := range regexp.MustCompile(`"[^"]*"`).FindAllString(condition, -1) {
+				if rand.Intn(2) == 0 {
+					s += str
+				}
+			}
+			if matching := e.Match(s); len(matching) == 1 {
+				t.Fatalf("%s: simplified condition %s is not equivalent for %s", condition, simplified, s)
+			}
+		}
+	}
+}
+
+func TestSimplifyAndPaths(t *testing.T) {
+	a, b, c := andString{literal: literal{str: "a"}}, andString{literal: literal{str: "b"}}, andString{literal: literal{str: "c"}}
+	notA := andString{not: true, literal: a.literal}
+	simplified := simplifyAndPaths([]andPath{{a, b, c}, {a, a, notA}, {b, b}, {a, c}, {b, c}})
+	assertTrue(t, reflect.DeepEqual(simplified, []andPath{{b}, {a, c}}))
+}
+
+func ExampleSimplify() {
+	simplified, err := Simplify(`"foo" OR ("foo" AND "bar") OR NOT (NOT "baz")`)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(simplified)
+	// Output:
+	// "foo" OR "baz"
+}
@@ -6,9 +6,33 @@ import (
 	"strings"
 )
 
+type literalKind int8
+
+const (
+	literalString    literalKind = iota // found with one of the Aho-Corasick automatons
+	literalRegex                        // verified with a regex after the Aho-Corasick prefilter
+	literalWildcard                     // verified with a wildcard pattern after the Aho-Corasick prefilter
+	literalOf                           // verified by counting the matching sub nodes of a nodeOF
+	literalCount                        // verified by counting the occurrences of a string
+	literalNear                         // verified with the distance between the occurrences of two strings
+	literalThen                         // verified with the order of the occurrences of multiple strings
+	literalNum                          // verified with the numeric value of a field
+	literalCondition                    // verified by evaluating a whole condition that has too many and-paths
+)
+
+// literal is a single entry of an and-path and of the decision tree
+type literal struct {
+	kind            literalKind
+	str             string
+	caseInsensitive bool
+	anchor          anchor
+	word            bool
+	field           string // empty if the literal can be found in any field
+}
+
 type andString struct {
 	not bool
-	str string
+	literal
 }
 
 type andStringIndex struct {
@@ -33,7 +57,41 @@ func (m andString) String() string {
 	if m.not {
 		prefix = "NOT "
 	}
-	return fmt.Sprintf("%s%q", prefix, m.str)
+	return prefix + m.literal.String()
+}
+
+func (l literal) String() string {
+	return l.quote(l.str, "")
+}
+
+// quote returns the string with the notation of the literal's kind and modifiers, flags are additional modifiers
+// that are appended to the string, e.g. the o of overlapping counts
+func (l literal) quote(s string, flags string) string {
+	var suffix string
+	if l.caseInsensitive {
+		suffix = "i"
+	}
+	var prefix string
+	if l.field != "" {
+		prefix = l.field + ":"
+	}
+	switch l.kind {
+	case literalRegex:
+		return prefix + quoteRegex(s) + suffix
+	case literalWildcard:
+		return prefix + fmt.Sprintf("w%q", s) + suffix
+	case literalOf, literalCount, literalNear, literalThen, literalNum, literalCondition:
+		return s
+	}
+	if l.word {
+		suffix += "w"
+	}
+	return prefix + l.anchor.quote(fmt.Sprintf("%q", s)+suffix+flags)
+}
+
+// plain returns the literal without anchors and word boundaries, which can be found by the Aho-Corasick automatons
+func (l literal) plain() literal {
+	return literal{str: l.str, caseInsensitive: l.caseInsensitive, field: l.field}
 }
 
 func getAndPaths(n node) []andPath {
@@ -47,12 +105,74 @@ func getAndPaths(n node) []andPath {
 			if !s1.not && s2.not {
 				return true
 			}
-			return strings.Compare(s1.str, s2.str) < 0
+			if s1.kind != s2.kind {
+				return s1.kind < s2.kind
+			}
+			if s1.field != s2.field {
+				return s1.field < s2.field
+			}
+			if s1.str != s2.str {
+				return strings.Compare(s1.str, s2.str) < 0
+			}
+			if s1.caseInsensitive != s2.caseInsensitive {
+				return !s1.caseInsensitive
+			}
+			if s1.anchor != s2.anchor {
+				return s1.anchor < s2.anchor
+			}
+			return !s1.word && s2.word
 		})
 	}
 	return res
 }
 
+// countAndPaths returns the number of and-paths of the SOP of the node without converting it, negated counts the
+// and-paths of the negated node. Counts that exceed the limit are returned as limit+1.
+func countAndPaths(n node, negated bool, limit int) int {
+	add := func(a, b int) int {
+		if a > limit-b {
+			return limit + 1
+		}
+		return a + b
+	}
+	mul := func(a, b int) int {
+		if a != 0 && b > limit/a {
+			return limit + 1
+		}
+		return a * b
+	}
+	switch v := n.(type) {
+	case nodeAND:
+		if negated {
+			return add(countAndPaths(v.node1, true, limit), countAndPaths(v.node2, true, limit))
+		}
+		return mul(countAndPaths(v.node1, false, limit), countAndPaths(v.node2, false, limit))
+	case nodeOR:
+		if negated {
+			return mul(countAndPaths(v.node1, true, limit), countAndPaths(v.node2, true, limit))
+		}
+		return add(countAndPaths(v.node1, false, limit), countAndPaths(v.node2, false, limit))
+	case nodeXOR:
+		// (a AND NOT b) OR (NOT a AND b), the negation is (a AND b) OR (NOT a AND NOT b)
+		a, notA := countAndPaths(v.node1, false, limit), countAndPaths(v.node1, true, limit)
+		b, notB := countAndPaths(v.node2, false, limit), countAndPaths(v.node2, true, limit)
+		if negated {
+			return add(mul(a, b), mul(notA, notB))
+		}
+		return add(mul(a, notB), mul(notA, b))
+	case nodeIMPLIES:
+		// NOT a OR b, the negation is a AND NOT b
+		if negated {
+			return mul(countAndPaths(v.node1, false, limit), countAndPaths(v.node2, true, limit))
+		}
+		return add(countAndPaths(v.node1, true, limit), countAndPaths(v.node2, false, limit))
+	case nodeNOT:
+		return countAndPaths(v.node, !negated, limit)
+	default:
+		return 1
+	}
+}
+
 func getUnsortedAndPaths(n node) []andPath {
 	switch v := n.(type) {
 	case nodeAND:
@@ -61,7 +181,8 @@ func getUnsortedAndPaths(n node) []andPath {
 		c2 := getUnsortedAndPaths(v.node2)
 		for _, andPathC1 := range c1 {
 			for _, andPathC2 := range c2 {
-				res = append(res, append(andPathC1, andPathC2...))
+				// the and-path is copied, because appending to andPathC1 would overwrite the other and-paths
+				res = append(res, append(append(andPath(nil), andPathC1...), andPathC2...))
 			}
 		}
 		return res
@@ -70,18 +191,18 @@ func getUnsortedAndPaths(n node) []andPath {
 		c2 := getUnsortedAndPaths(v.node2)
 		return append(c1, c2...)
 	case nodeNOT:
-		val := v.node.(nodeVAL)
+		val := v.node.(leaf)
 		return []andPath{
 			{andString{
-				not: true,
-				str: val.nodeValue,
+				not:     true,
+				literal: val.literal(),
 			}},
 		}
-	case nodeVAL:
+	case leaf:
 		return []andPath{
 			{andString{
-				not: false,
-				str: v.nodeValue,
+				not:     false,
+				literal: v.literal(),
 			}},
 		}
 	default:
@@ -139,6 +260,26 @@ func (n nodeOR) SOP() node {
 	return n
 }
 
+// SOP of a nodeXOR rewrites it to (node1 AND NOT node2) OR (NOT node1 AND node2)
+func (n nodeXOR) SOP() node {
+	return (nodeOR{
+		twoSubNodes{
+			node1: nodeAND{twoSubNodes{node1: n.node1, node2: nodeNOT{oneSubNode{node: n.node2}}}},
+			node2: nodeAND{twoSubNodes{node1: nodeNOT{oneSubNode{node: n.node1}}, node2: n.node2}},
+		},
+	}).SOP()
+}
+
+// SOP of a nodeIMPLIES rewrites it to NOT node1 OR node2
+func (n nodeIMPLIES) SOP() node {
+	return (nodeOR{
+		twoSubNodes{
+			node1: nodeNOT{oneSubNode{node: n.node1}},
+			node2: n.node2,
+		},
+	}).SOP()
+}
+
 func (n nodeNOT) SOP() node {
 	//n.node = n.node.SOP()
 	switch v := n.node.(type) {
@@ -172,8 +313,29 @@ func (n nodeNOT) SOP() node {
 				},
 			},
 		}).SOP()
-	case nodeVAL:
+	case nodeXOR:
+		// NOT (a XOR b) is (a AND b) OR (NOT a AND NOT b)
+		return (nodeOR{
+			twoSubNodes{
+				node1: nodeAND{twoSubNodes{node1: v.node1, node2: v.node2}},
+				node2: nodeAND{twoSubNodes{node1: nodeNOT{oneSubNode{node: v.node1}}, node2: nodeNOT{oneSubNode{node: v.node2}}}},
+			},
+		}).SOP()
+	case nodeIMPLIES:
+		// NOT (a IMPLIES b) is a AND NOT b
+		return (nodeAND{
+			twoSubNodes{
+				node1: v.node1,
+				node2: nodeNOT{oneSubNode{node: v.node2}},
+			},
+		}).SOP()
+	case nodeVAL, nodeREGEX, nodeWILDCARD, nodeOF, nodeNEAR, nodeTHEN, nodeNUM:
+		// the negation of a nodeNUM is not the negated comparison, because missing fields and non-numeric values
+		// satisfy neither of them
 		return n
+	case nodeCOUNT:
+		v.comparison = v.comparison.negate()
+		return v
 	case nodeNOT:
 		return v.node.SOP()
 	default:
@@ -184,3 +346,32 @@ func (n nodeNOT) SOP() node {
 func (n nodeVAL) SOP() node {
 	return n
 }
+
+func (n nodeREGEX) SOP() node {
+	return n
+}
+
+func (n nodeWILDCARD) SOP() node {
+	return n
+}
+
+func (n nodeNEAR) SOP() node {
+	return n
+}
+
+func (n nodeTHEN) SOP() node {
+	return n
+}
+
+func (n nodeCOUNT) SOP() node {
+	return n
+}
+
+func (n nodeNUM) SOP() node {
+	return n
+}
+
+// SOP of a nodeOF does not expand all combinations of its sub nodes, the nodeOF is verified as a whole
+func (n nodeOF) SOP() node {
+	return n
+}
@@ -49,7 +49,7 @@ func dnf(cond string) {
 	}
 }
 
-func ExampleDNF() {
+func Example_dnf() {
 	dnf(`"a"`)
 	dnf(`NOT "a"`)
 	dnf(`"a" AND "b"`)
@@ -95,7 +95,7 @@ func ExampleDNF() {
 	// after: "a" OR "b" OR "c" OR "d"
 }
 
-func ExampleSOP() {
+func Example_sop() {
 	sop(`"a"`)
 	sop(`NOT "a"`)
 	sop(`"a" AND "b"`)
@@ -111,6 +111,11 @@ func ExampleSOP() {
 	sop(`"a" OR NOT ("b" AND NOT "c")`)
 	sop(`"a" OR ("b" OR ("c" OR "d"))`)
 	sop(`("a" OR "b") OR ("c" OR "d")`)
+	sop(`"a" AND NOT (#"b" > 2 OR #"c"o == 1)`)
+	sop(`"a" XOR "b"`)
+	sop(`NOT ("a" XOR "b")`)
+	sop(`"a" -> "b" AND "c"`)
+	sop(`NOT ("a" -> "b")`)
 	// Output:
 	// ----- "a" -----
 	// before: "a"
@@ -157,9 +162,24 @@ func ExampleSOP() {
 	// ----- ("a" OR "b") OR ("c" OR "d") -----
 	// before: (("a" OR "b") OR ("c" OR "d"))
 	// after: (("a" OR "b") OR ("c" OR "d"))
+	// ----- "a" AND NOT (#"b" > 2 OR #"c"o == 1) -----
+	// before: ("a" AND NOT (#"b" > 2 OR #"c"o == 1))
+	// after: ("a" AND (#"b" <= 2 AND #"c"o != 1))
+	// ----- "a" XOR "b" -----
+	// before: ("a" XOR "b")
+	// after: (("a" AND NOT "b") OR (NOT "a" AND "b"))
+	// ----- NOT ("a" XOR "b") -----
+	// before: NOT ("a" XOR "b")
+	// after: (("a" AND "b") OR (NOT "a" AND NOT "b"))
+	// ----- "a" -> "b" AND "c" -----
+	// before: ("a" IMPLIES ("b" AND "c"))
+	// after: (NOT "a" OR ("b" AND "c"))
+	// ----- NOT ("a" -> "b") -----
+	// before: NOT ("a" IMPLIES "b")
+	// after: ("a" AND NOT "b")
 }
 
-func ExampleSOP_2() {
+func Example_sop_2() {
 	sop(`("a" OR "b" OR "c") AND NOT ("d" OR "e" OR "f") AND ("g" OR "h" OR "i")`)
 	sop(`NOT (("a" OR "b" OR "c") AND NOT ("d" OR "e" OR "f") AND ("g" OR "h" OR "i"))`)
 	// Output:
@@ -171,7 +191,7 @@ func ExampleSOP_2() {
 	// after: ((((NOT "a" AND NOT "b") AND NOT "c") OR (("d" OR "e") OR "f")) OR ((NOT "g" AND NOT "h") AND NOT "i"))
 }
 
-func ExampleMatchStrings() {
+func Example_matchStrings() {
 	ms := func(cond string) {
 		n, err := parseCondition(cond)
 		if err != nil {
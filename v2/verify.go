@@ -0,0 +1,357 @@
+package evalostic
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// verifiedLiteral is a literal that can not be found by the Aho-Corasick automatons directly, it is verified
+// after the automatons found the strings of its prefilter
+type verifiedLiteral struct {
+	index     int     // index of the literal in the strings map
+	prefilter [][]int // all strings of at least one alternative have to be found before verify is called, nil if there is no prefilter
+	verify    func(m *matchState) bool
+	field     string // the literal is only verified with the string of this field, empty if it is verified with all fields
+	global    bool   // the literal only depends on other literals and is verified once after all fields
+	// count returns the occurrences of a counted string in the string of a single field, they are summed over all
+	// fields before the count is verified once after all fields. nil if the literal is no count.
+	count func(m *matchState) int
+}
+
+// prefiltered returns true if the strings that were found by the Aho-Corasick automatons satisfy the prefilter
+func (v verifiedLiteral) prefiltered(found map[decisionTreeEntry]struct{}) bool {
+	if v.prefilter == nil {
+		return true
+	}
+alternatives:
+	for _, alternative := range v.prefilter {
+		for _, strI := range alternative {
+			if _, ok := found[decisionTreeEntry{value: strI}]; !ok {
+				continue alternatives
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// matchState contains everything that the Aho-Corasick automatons found in a string
+type matchState struct {
+	s      string
+	lower  string // lowercased s, case insensitive strings are searched in here
+	found  map[decisionTreeEntry]struct{}
+	counts map[int]int   // occurrences of the counts that are summed over all fields, see verifiedLiteral.count
+	ends   map[int][]int // end positions of the found strings, only for strings that are needed to verify other literals
+	num    *float64      // numeric value of s, parsed by the first numeric comparison
+	isNum  bool
+	// offsets[i] is the offset in s of the byte i of the lowercased string, whose characters can have a different
+	// length, see originalOffset
+	offsets []int
+	// runes[i] and wordStarts[i] are the number of characters and the number of beginnings of words in s[:i], see
+	// distance
+	runes, wordStarts []int
+}
+
+func (m *matchState) add(strI, end int, positional map[int]struct{}) {
+	m.found[decisionTreeEntry{value: strI}] = struct{}{}
+	if _, ok := positional[strI]; ok {
+		m.ends[strI] = append(m.ends[strI], end)
+	}
+}
+
+// lowered returns the lowercased string
+func (m *matchState) lowered() string {
+	if m.lower == "" && m.s != "" {
+		m.lower = strings.ToLower(m.s)
+	}
+	return m.lower
+}
+
+// numberValue matches the numeric values of fields, which have the same syntax as numbers in conditions, e.g. NaN or
+// 0x1p3 are no numbers
+var numberValue = regexp.MustCompile(`^` + numberSyntax + `$`)
+
+// number returns the numeric value of the string, ok is false if the string is not a number
+func (m *matchState) number() (value float64, ok bool) {
+	if m.num == nil {
+		s := strings.TrimSpace(m.s)
+		value, err := strconv.ParseFloat(s, 64)
+		m.num, m.isNum = &value, err == nil && numberValue.MatchString(s)
+	}
+	return *m.num, m.isNum
+}
+
+// originalOffset returns the offset in s of an offset in the lowercased string
+func (m *matchState) originalOffset(offset int) int {
+	if m.offsets == nil {
+		// strings.ToLower lowercases each character and replaces invalid bytes with utf8.RuneError, just like range
+		m.offsets = make([]int, 0, len(m.lowered())+1)
+		for i, r := range m.s {
+			for n := utf8.RuneLen(unicode.ToLower(r)); n > 0; n-- {
+				m.offsets = append(m.offsets, i)
+			}
+		}
+		m.offsets = append(m.offsets, len(m.s))
+	}
+	return m.offsets[offset]
+}
+
+// distance returns the number of characters, or the number of words, in s[start:end]
+func (m *matchState) distance(start, end int, words bool) int {
+	if start >= end {
+		return 0
+	}
+	if m.runes == nil {
+		m.runes, m.wordStarts = make([]int, len(m.s)+1), make([]int, len(m.s)+1)
+		var runes, wordStarts int
+		var inWord bool
+		for i := 0; i < len(m.s); {
+			r, size := utf8.DecodeRuneInString(m.s[i:])
+			for j := i; j < i+size; j++ {
+				m.runes[j], m.wordStarts[j] = runes, wordStarts
+			}
+			if isWordRune(r) && !inWord {
+				wordStarts++
+			}
+			runes, inWord, i = runes+1, isWordRune(r), i+size
+		}
+		m.runes[len(m.s)], m.wordStarts[len(m.s)] = runes, wordStarts
+	}
+	if !words {
+		return m.runes[end] - m.runes[start]
+	}
+	count := m.wordStarts[end] - m.wordStarts[start]
+	// a word that begins before start is counted if it continues in s[start:end]
+	if r, _ := utf8.DecodeRuneInString(m.s[start:]); start > 0 && isWordRune(r) {
+		if r, _ := utf8.DecodeLastRuneInString(m.s[:start]); isWordRune(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// searched returns the string in which the automatons searched for the literal
+func (m *matchState) searched(l literal) string {
+	if l.caseInsensitive {
+		return m.lowered()
+	}
+	return m.s
+}
+
+// compileCondition returns a function that evaluates a condition with the found literals, all literals of the
+// condition have to be added to the strings map before
+func (e *Evalostic) compileCondition(n node) func(found map[decisionTreeEntry]struct{}) bool {
+	switch v := n.(type) {
+	case nodeAND:
+		c1, c2 := e.compileCondition(v.node1), e.compileCondition(v.node2)
+		return func(found map[decisionTreeEntry]struct{}) bool { return c1(found) && c2(found) }
+	case nodeOR:
+		c1, c2 := e.compileCondition(v.node1), e.compileCondition(v.node2)
+		return func(found map[decisionTreeEntry]struct{}) bool { return c1(found) || c2(found) }
+	case nodeXOR:
+		c1, c2 := e.compileCondition(v.node1), e.compileCondition(v.node2)
+		return func(found map[decisionTreeEntry]struct{}) bool { return c1(found) != c2(found) }
+	case nodeIMPLIES:
+		c1, c2 := e.compileCondition(v.node1), e.compileCondition(v.node2)
+		return func(found map[decisionTreeEntry]struct{}) bool { return !c1(found) || c2(found) }
+	case nodeNOT:
+		c := e.compileCondition(v.node)
+		return func(found map[decisionTreeEntry]struct{}) bool { return !c(found) }
+	case leaf:
+		entry := decisionTreeEntry{value: e.strings[v.literal()]}
+		return func(found map[decisionTreeEntry]struct{}) bool {
+			_, ok := found[entry]
+			return ok
+		}
+	default:
+		panic("unknown node type")
+	}
+}
+
+// ofMatcher returns a function that counts the matching sub nodes of a nodeOF
+func (e *Evalostic) ofMatcher(n nodeOF) func(m *matchState) bool {
+	subConditions := make([]func(found map[decisionTreeEntry]struct{}) bool, len(n.nodes))
+	for i, subNode := range n.nodes {
+		subConditions[i] = e.compileCondition(subNode)
+	}
+	return func(m *matchState) bool {
+		var matches int
+		for i, subCondition := range subConditions {
+			if subCondition(m.found) {
+				matches++
+				if matches >= n.min {
+					return true
+				}
+			} else if matches+len(subConditions)-i-1 < n.min {
+				return false // the remaining sub nodes can not reach the threshold anymore
+			}
+		}
+		return false
+	}
+}
+
+// positionMatcher returns a function that checks the anchor and word boundaries of the literal with the positions of
+// the plain string
+func positionMatcher(l literal, plainI int) func(m *matchState) bool {
+	return func(m *matchState) bool {
+		s := m.searched(l)
+		for _, end := range m.ends[plainI] {
+			if l.matchesAt(s, end-len(l.str), end) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// numMatcher returns a function that compares the numeric value of the field
+func numMatcher(n nodeNUM) func(m *matchState) bool {
+	return func(m *matchState) bool {
+		value, ok := m.number()
+		return ok && n.matches(value)
+	}
+}
+
+// countMatcher returns a function that counts the occurrences of the plain string that satisfy the anchor and word
+// boundaries of the counted string
+func countMatcher(n nodeCOUNT, plainI int) func(m *matchState) int {
+	l := n.val.literal()
+	return func(m *matchState) int {
+		var count, lastEnd int
+		for _, o := range m.occurrences(l, plainI) { // the Aho-Corasick automatons report the positions in ascending order
+			if !n.overlapping && count > 0 && o.start < lastEnd {
+				continue
+			}
+			count++
+			lastEnd = o.end
+		}
+		return count
+	}
+}
+
+// occurrence is the position s[start:end] of a string
+type occurrence struct{ start, end int }
+
+// occurrences returns all occurrences of the plain string that satisfy the anchor and word boundaries of the literal
+func (m *matchState) occurrences(l literal, plainI int) []occurrence {
+	s := m.searched(l)
+	var res []occurrence
+	for _, end := range m.ends[plainI] {
+		if start := end - len(l.str); l.matchesAt(s, start, end) {
+			res = append(res, occurrence{start: start, end: end})
+		}
+	}
+	return res
+}
+
+// positions returns the occurrences of the literal like occurrences, but as positions in s instead of the lowercased
+// string for case insensitive literals, so that they can be compared with the positions of case sensitive literals
+func (m *matchState) positions(l literal, plainI int) []occurrence {
+	occurrences := m.occurrences(l, plainI)
+	if l.caseInsensitive {
+		for i, o := range occurrences {
+			occurrences[i] = occurrence{start: m.originalOffset(o.start), end: m.originalOffset(o.end)}
+		}
+	}
+	return occurrences
+}
+
+// nearMatcher returns a function that checks if occurrences of both strings of a nodeNEAR are close enough to each
+// other. Only the closest occurrences of the second string before and after each occurrence of the first string are
+// compared, both are found by a single sweep over the sorted occurrences.
+func nearMatcher(n nodeNEAR, plainI1, plainI2 int) func(m *matchState) bool {
+	l1, l2 := n.val1.literal(), n.val2.literal()
+	return func(m *matchState) bool {
+		occurrences2 := m.positions(l2, plainI2)
+		// occurrences2[:before] end before o1 starts and occurrences2[:after] start before o1 ends, so
+		// occurrences2[before:after] overlap o1
+		var before, after int
+		for _, o1 := range m.positions(l1, plainI1) {
+			for before < len(occurrences2) && occurrences2[before].end <= o1.start {
+				before++
+			}
+			for after < len(occurrences2) && occurrences2[after].start < o1.end {
+				after++
+			}
+			switch {
+			case before < after:
+				return true
+			case before > 0 && n.gap.allows(m.distance(occurrences2[before-1].end, o1.start, n.gap.words)):
+				return true
+			case after < len(occurrences2) && n.gap.allows(m.distance(o1.end, occurrences2[after].start, n.gap.words)):
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// thenMatcher returns a function that checks if the strings of a nodeTHEN occur in order without overlapping and
+// without exceeding the maximum gaps. Only the closest reachable occurrence before each occurrence of the next string
+// is compared, it is found by a single sweep over the sorted occurrences.
+func thenMatcher(n nodeTHEN, plainIndices []int) func(m *matchState) bool {
+	return func(m *matchState) bool {
+		var reachable []occurrence // occurrences of the current string that complete the sequence up to this string
+		for i, val := range n.vals {
+			occurrences := m.positions(val.literal(), plainIndices[i])
+			if i == 0 {
+				reachable = occurrences
+				continue
+			}
+			gap := n.gaps[i-1]
+			var next []occurrence
+			var previous int // reachable[:previous] end before o starts
+			for _, o := range occurrences {
+				for previous < len(reachable) && reachable[previous].end <= o.start {
+					previous++
+				}
+				if previous > 0 && gap.allows(m.distance(reachable[previous-1].end, o.start, gap.words)) {
+					next = append(next, o)
+				}
+			}
+			if reachable = next; len(reachable) == 0 {
+				return false
+			}
+		}
+		return len(reachable) > 0
+	}
+}
+
+// matchesAt checks the anchor and word boundaries of the literal that was found at s[start:end]
+func (l literal) matchesAt(s string, start, end int) bool {
+	if l.word && !isWordBoundary(s, start, end) {
+		return false
+	}
+	switch l.anchor {
+	case anchorStart:
+		return start == 0
+	case anchorEnd:
+		return end == len(s)
+	case anchorEqual:
+		return start == 0 && end == len(s)
+	default:
+		return true
+	}
+}
+
+// isWordBoundary checks that s[start:end] is not directly surrounded by word characters
+func isWordBoundary(s string, start, end int) bool {
+	if start > 0 {
+		if r, _ := utf8.DecodeLastRuneInString(s[:start]); isWordRune(r) {
+			return false
+		}
+	}
+	if end < len(s) {
+		if r, _ := utf8.DecodeRuneInString(s[end:]); isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
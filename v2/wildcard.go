@@ -0,0 +1,75 @@
+package evalostic
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// wildcardPrefilter returns the fragments between the wildcards * and ?, all of them are required for a match
+func wildcardPrefilter(l literal) [][]literal {
+	var alternative []literal
+	for _, fragment := range strings.FieldsFunc(l.str, isWildcard) {
+		alternative = append(alternative, literal{str: fragment, caseInsensitive: l.caseInsensitive})
+	}
+	if alternative == nil {
+		return nil
+	}
+	return [][]literal{alternative}
+}
+
+func isWildcard(r rune) bool {
+	return r == '*' || r == '?'
+}
+
+// wildcardMatcher returns a function that checks whether a string contains the wildcard pattern, a * matches any
+// number of characters and a ? matches exactly one character
+func wildcardMatcher(l literal) func(m *matchState) bool {
+	segments := strings.Split(l.str, "*")
+	return func(m *matchState) bool {
+		s := m.searched(l)
+		// the pattern is not anchored, so the leftmost occurrence of each segment leaves the most space for the next ones
+		for _, segment := range segments {
+			_, end := indexSegment(s, segment)
+			if end < 0 {
+				return false
+			}
+			s = s[end:]
+		}
+		return true
+	}
+}
+
+// indexSegment returns the start and end of the first occurrence of a segment in s, a ? in the segment matches
+// exactly one character
+func indexSegment(s, segment string) (int, int) {
+	if !strings.ContainsRune(segment, '?') {
+		i := strings.Index(s, segment)
+		if i < 0 {
+			return -1, -1
+		}
+		return i, i + len(segment)
+	}
+	for start := 0; start < len(s); {
+		if end, ok := matchSegmentAt(s[start:], segment); ok {
+			return start, start + end
+		}
+		_, size := utf8.DecodeRuneInString(s[start:])
+		start += size
+	}
+	return -1, -1
+}
+
+func matchSegmentAt(s, segment string) (int, bool) {
+	var i int
+	for _, r := range segment {
+		if i >= len(s) {
+			return 0, false
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if r != '?' && r != c {
+			return 0, false
+		}
+		i += size
+	}
+	return i, true
+}
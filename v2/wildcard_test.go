@@ -0,0 +1,35 @@
+package evalostic
+
+import "fmt"
+
+func Example_wildcardMatcher() {
+	wm := func(cond string, s string) {
+		root, err := parseCondition(cond)
+		if err != nil {
+			panic(err)
+		}
+		l := root.(nodeWILDCARD).literal()
+		fmt.Printf("%s %q: %t %v\n", cond, s, wildcardMatcher(l)(&matchState{s: s}), wildcardPrefilter(l))
+	}
+	wm(`w"cmd.exe*/c"`, `cmd.exe /c whoami`)
+	wm(`w"cmd.exe*/c"`, `/c cmd.exe`)
+	wm(`w"CMD.EXE*/C"i`, `Cmd.Exe /c whoami`)
+	wm(`w"a?c"`, `xabcx`)
+	wm(`w"a?c"`, `xacx`)
+	wm(`w"a?c"`, `xaäcx`)
+	wm(`w"a*b*a"`, `aba`)
+	wm(`w"a*b*a"`, `ab`)
+	wm(`w"*"`, ``)
+	wm(`w"?"`, ``)
+	// Output:
+	// w"cmd.exe*/c" "cmd.exe /c whoami": true [["cmd.exe" "/c"]]
+	// w"cmd.exe*/c" "/c cmd.exe": false [["cmd.exe" "/c"]]
+	// w"CMD.EXE*/C"i "Cmd.Exe /c whoami": true [["cmd.exe"i "/c"i]]
+	// w"a?c" "xabcx": true [["a" "c"]]
+	// w"a?c" "xacx": false [["a" "c"]]
+	// w"a?c" "xaäcx": true [["a" "c"]]
+	// w"a*b*a" "aba": true [["a" "b" "a"]]
+	// w"a*b*a" "ab": false [["a" "b" "a"]]
+	// w"*" "": true []
+	// w"?" "": false []
+}